@@ -0,0 +1,60 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sync"
+)
+
+const compileCacheSize = 256
+
+// Compiled paths shared by QueryString.
+// NOTE: The cache is simply cleared when it is full.
+var compileCache = struct {
+	sync.Mutex
+	paths map[string]*CompiledJSONPath
+}{
+	paths: make(map[string]*CompiledJSONPath),
+}
+
+func compileCached(path string) (*CompiledJSONPath, error) {
+	compileCache.Lock()
+	p, ok := compileCache.paths[path]
+	compileCache.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	p, err := Compile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compileCache.Lock()
+	if len(compileCache.paths) >= compileCacheSize {
+		compileCache.paths = make(map[string]*CompiledJSONPath)
+	}
+	compileCache.paths[path] = p
+	compileCache.Unlock()
+
+	return p, nil
+}
+
+// QueryString compiles the path (using the cache) and queries the JSON.
+// Compile errors are wrapped (errors.As can get the *PathError).
+func QueryString(pjson *parsedJSON, path string) (interface{}, error) {
+	p, err := compileCached(path)
+	if err != nil {
+		return nil, fmt.Errorf("QueryString: Compile: %w", err)
+	}
+	return p.Query(pjson)
+}
+
+// PathExists compiles the path (using the cache) and reports whether it points to a value.
+// It returns false if the path cannot be compiled.
+func PathExists(pjson *parsedJSON, path string) bool {
+	p, err := compileCached(path)
+	if err != nil {
+		return false
+	}
+	return p.Exists(pjson)
+}
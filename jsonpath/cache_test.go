@@ -0,0 +1,205 @@
+package jsonpath_test
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestQueryString(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"a":1}`,
+		path:    `$.a`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":"x"}`,
+		path:    `$.a`,
+		want:    "x",
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"a":[1]}`,
+		path:    `$.a`,
+		want:    []interface{}{float64(1)},
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"a":{"b":1}}`,
+		path:    `$.a`,
+		want:    map[string]interface{}{"b": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `{"a":{"b":1}}`,
+		path:    `$.c`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			// NOTE: The second call uses the cached path.
+			for i := 0; i < 2; i++ {
+				v, err := jsonpath.QueryString(json, tt.path)
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("%v: QueryString: want error: v = %v", tt.name, v)
+						return
+					}
+				} else {
+					if err != nil {
+						t.Errorf("%v: QueryString: error = %v", tt.name, err)
+						return
+					}
+				}
+
+				if !reflect.DeepEqual(v, tt.want) {
+					t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestQueryStringCompileError(t *testing.T) {
+	json, err := jsonpath.ReadString(`{"a":1}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	_, err = jsonpath.QueryString(json, `$.a[`)
+	var pe *jsonpath.PathError
+	if !errors.As(err, &pe) {
+		t.Errorf("QueryString: want PathError: error = %v", err)
+		return
+	}
+	if pe.Pos != 3 {
+		t.Errorf("Pos = %v, want = %v", pe.Pos, 3)
+		return
+	}
+}
+
+func TestQueryStringConcurrent(t *testing.T) {
+	json, err := jsonpath.ReadString(`[0,1,2,3,4,5,6,7,8,9]`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// NOTE: More paths than the cache size.
+			for i := 0; i < 1000; i++ {
+				v, err := jsonpath.QueryString(json, `$[`+strconv.Itoa(i%10)+`]`+strings.Repeat(" ", i/10))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if v != float64(i%10) {
+					errs <- errors.New("unexpected value")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("QueryString: error = %v", err)
+	}
+}
+
+func TestPathExists(t *testing.T) {
+	const src = `{"a":{"b":null,"c":[1]},"d":[]}`
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{{
+		name: "1",
+		path: `$.a`,
+		want: true,
+	}, {
+		name: "2",
+		path: `$.a.b`,
+		want: true,
+	}, {
+		name: "3",
+		path: `$.a.c[0]`,
+		want: true,
+	}, {
+		name: "4",
+		path: `$.a.x`,
+		want: false,
+	}, {
+		name: "5",
+		path: `$.a.c[1]`,
+		want: false,
+	}, {
+		name: "6",
+		path: `$.a.b.x`,
+		want: false,
+	}, {
+		name: "7",
+		path: `$..c`,
+		want: true,
+	}, {
+		name: "8",
+		path: `$.d[*]`,
+		want: false,
+	}, {
+		name: "9",
+		path: `$.a[`,
+		want: false,
+	}, {
+		name: "10",
+		path: `a`,
+		want: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			if got := jsonpath.PathExists(json, tt.path); got != tt.want {
+				t.Errorf("%v: PathExists() = %v, want = %v", tt.name, got, tt.want)
+			}
+
+			if path, err := jsonpath.Compile(tt.path); err == nil {
+				if got := path.Exists(json); got != tt.want {
+					t.Errorf("%v: Exists() = %v, want = %v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package jsonpath
+
+import (
+	"errors"
+)
+
+// Cursor iterates over the values that the path points to, in the same order as QueryAll.
+// The values are computed lazily on each Next, so that the iteration can stop early.
+// The cursor is not safe for concurrent use.
+type Cursor struct {
+	path    *CompiledJSONPath
+	c       *queryContext
+	pending []cursorFrame
+	value   interface{}
+}
+
+// The value v to be navigated by the segments from level.
+// If filter is not nil, v is the child to be tested by the filter before that.
+type cursorFrame struct {
+	level  int
+	v      interface{}
+	filter *filterExpr
+}
+
+// QueryCursor returns the cursor over the values that the path points to, in the same order as WalkMatches.
+// Like WalkMatches, the items of the unions of indices and the slices of arrays are flattened.
+// If the path is single-valued, the value is queried at once as Query; the cursor yields it as one value
+// (or its items, if the last segment is the union of indices or the slice of an array).
+// Like QueryAll, it is an error if the value does not exist.
+func (p *CompiledJSONPath) QueryCursor(pjson *parsedJSON) (*Cursor, error) {
+	if pjson.typ == Type_Invalid {
+		return nil, errors.New("QueryCursor: JSON is not read")
+	}
+
+	c := &queryContext{
+		root:    pjson.value,
+		opts:    p.opts,
+		ordered: pjson.ordered,
+	}
+
+	if p.multi {
+		return &Cursor{
+			path:    p,
+			c:       c,
+			pending: []cursorFrame{{v: pjson.value}},
+		}, nil
+	}
+
+	v, err := p.query(c, pjson.value)
+	if err != nil {
+		return nil, err
+	}
+	items := p.selectedItems(v)
+	pending := make([]cursorFrame, len(items))
+	for j, w := range items {
+		pending[len(items)-1-j] = cursorFrame{level: len(p.asts), v: w}
+	}
+	return &Cursor{
+		path:    p,
+		c:       c,
+		pending: pending,
+	}, nil
+}
+
+// Next advances the cursor to the next value. It returns false if there are no more values.
+func (r *Cursor) Next() bool {
+	p := r.path
+
+	for len(r.pending) > 0 {
+		f := r.pending[len(r.pending)-1]
+		r.pending = r.pending[:len(r.pending)-1]
+
+		if f.filter != nil && !f.filter.eval(r.c, f.v) {
+			continue
+		}
+		if f.level == len(p.asts) {
+			r.value = f.v
+			return true
+		}
+
+		// NOTE: The frames are pushed in reverse order, that yields the same order as WalkMatches.
+		a := &p.asts[f.level]
+		switch a.typ {
+		case astType_RecursiveDescent:
+			ch := children(f.v)
+			for j := len(ch) - 1; j >= 0; j-- {
+				r.pending = append(r.pending, cursorFrame{level: f.level, v: ch[j]})
+			}
+			r.pending = append(r.pending, cursorFrame{level: f.level + 1, v: f.v})
+		case astType_Filter:
+			ch := children(f.v)
+			for j := len(ch) - 1; j >= 0; j-- {
+				r.pending = append(r.pending, cursorFrame{level: f.level + 1, v: ch[j], filter: a.filter})
+			}
+		case astType_Wildcard:
+			ch := children(f.v)
+			for j := len(ch) - 1; j >= 0; j-- {
+				r.pending = append(r.pending, cursorFrame{level: f.level + 1, v: ch[j]})
+			}
+		case astType_Union, astType_Slice:
+			ch := p.selectItems(r.c, f.level, a, f.v)
+			for j := len(ch) - 1; j >= 0; j-- {
+				r.pending = append(r.pending, cursorFrame{level: f.level + 1, v: ch[j]})
+			}
+		default:
+			w, err := p.step(r.c, f.level, a, f.v)
+			if err == nil {
+				r.pending = append(r.pending, cursorFrame{level: f.level + 1, v: w})
+			}
+		}
+	}
+
+	r.value = nil
+	return false
+}
+
+// Value returns the current value. It is nil before the first Next and after Next returns false.
+func (r *Cursor) Value() interface{} {
+	return r.value
+}
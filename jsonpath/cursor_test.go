@@ -0,0 +1,172 @@
+package jsonpath_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestQueryCursor(t *testing.T) {
+	const src = `{"a":[{"x":1,"y":{"x":2}},{"x":3}],"b":{"x":4},"c":null,"z":[5,6,7]}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	for _, p := range []string{`$..x`, `$.a[*].x`, `$.z.*`, `$.a[?(@.x >= 1)].x`, `$.a[0].x`, `$.c`, `$..[?(@.x)].x`, `$.missing[*]`, `$..*`} {
+		path, err := jsonpath.Compile(p)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", p, err)
+			return
+		}
+		want, err := path.QueryAll(json)
+		if err != nil {
+			t.Errorf("%v: QueryAll: error = %v", p, err)
+			return
+		}
+
+		cur, err := path.QueryCursor(json)
+		if err != nil {
+			t.Errorf("%v: QueryCursor: error = %v", p, err)
+			return
+		}
+		got := make([]interface{}, 0)
+		for cur.Next() {
+			got = append(got, cur.Value())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got = %v, want = %v", p, got, want)
+		}
+		if cur.Next() || cur.Value() != nil {
+			t.Errorf("%v: Next after the end: want false", p)
+		}
+	}
+
+	path, _ := jsonpath.Compile(`$.a[5]`)
+	if _, err := path.QueryCursor(json); err == nil {
+		t.Errorf("QueryCursor: want error")
+	}
+}
+
+func TestQueryCursorEarlyTermination(t *testing.T) {
+	const src = `{"a":[{"x":1,"y":{"x":2}},{"x":3}],"b":{"x":4}}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	path, _ := jsonpath.Compile(`$..x`)
+	cur, err := path.QueryCursor(json)
+	if err != nil {
+		t.Errorf("QueryCursor: error = %v", err)
+		return
+	}
+
+	n := 0
+	for cur.Next() {
+		n++
+		if cur.Value() == float64(2) {
+			break
+		}
+	}
+	if n != 2 {
+		t.Errorf("Next: %v values before the stop, want = %v", n, 2)
+	}
+
+	// The iteration can be resumed after the stop.
+	rest := make([]interface{}, 0)
+	for cur.Next() {
+		rest = append(rest, cur.Value())
+	}
+	if want := []interface{}{float64(3), float64(4)}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %v, want = %v", rest, want)
+	}
+
+	path, _ = jsonpath.Compile(`$.b.x`)
+	cur, err = path.QueryCursor(json)
+	if err != nil {
+		t.Errorf("QueryCursor: error = %v", err)
+		return
+	}
+	if cur.Value() != nil {
+		t.Errorf("Value before Next = %v, want = nil", cur.Value())
+	}
+	if !cur.Next() || cur.Value() != float64(4) {
+		t.Errorf("Next: value = %v, want = %v", cur.Value(), 4)
+	}
+	if cur.Next() {
+		t.Errorf("Next: single-valued path yields more than one value")
+	}
+}
+
+func TestQueryCursorUnionAndSlice(t *testing.T) {
+	const src = `{"a":[{"x":1,"y":{"x":2}},{"x":3}],"b":{"x":4},"z":[5,6,7],"s":"héllo","d":{"v":[1,2],"e":{"v":[3]}}}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	for _, p := range []string{`$.z[0,2]`, `$.z[1:]`, `$[*][-1,0].x`, `$..v[0,1]`, `$.b['x','w']`, `$.s[1:3]`, `$.a[0,1][1]`} {
+		path, err := jsonpath.Compile(p)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", p, err)
+			return
+		}
+		want := make([]interface{}, 0)
+		err = path.WalkMatches(json, func(v interface{}) error {
+			want = append(want, v)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%v: WalkMatches: error = %v", p, err)
+			return
+		}
+
+		cur, err := path.QueryCursor(json)
+		if err != nil {
+			t.Errorf("%v: QueryCursor: error = %v", p, err)
+			return
+		}
+		got := make([]interface{}, 0)
+		for cur.Next() {
+			got = append(got, cur.Value())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got = %v, want = %v", p, got, want)
+		}
+	}
+
+	path, _ := jsonpath.Compile(`$.z[0,2]`)
+	cur, _ := path.QueryCursor(json)
+	if !cur.Next() || cur.Value() != float64(5) {
+		t.Errorf("Next: value = %v, want = %v", cur.Value(), 5)
+	}
+
+	// The slice of a string yields the substring as Query.
+	path, _ = jsonpath.Compile(`$.s[1:3]`)
+	cur, err = path.QueryCursor(json)
+	if err != nil {
+		t.Errorf("QueryCursor: error = %v", err)
+		return
+	}
+	if !cur.Next() || cur.Value() != "él" {
+		t.Errorf("Next: value = %v, want = %v", cur.Value(), "él")
+	}
+	if cur.Next() {
+		t.Errorf("Next: string slice yields more than one value")
+	}
+
+	for _, p := range []string{`$.s[0,1]`, `$.a[0:2].x`, `$.missing[0,1]`} {
+		path, _ := jsonpath.Compile(p)
+		if _, err := path.QueryCursor(json); err == nil {
+			t.Errorf("%v: QueryCursor: want error", p)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package jsonpath
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const binaryFormatVersion = 1
+
+const (
+	binaryFlag_Relative = 1 << iota
+	binaryFlag_CaseInsensitive
+	binaryFlag_AutoMapArrays
+	binaryFlag_DisableWildcards
+	binaryFlag_ExtendedBareNames
+	binaryFlag_StrictEscapes
+	binaryFlag_LenientIndex
+)
+
+const (
+	binaryArg_Null byte = iota
+	binaryArg_False
+	binaryArg_True
+	binaryArg_Number
+	binaryArg_String
+	binaryArg_Int
+)
+
+// String returns the canonical form of the path.
+// Compiling the returned string yields an equivalent path.
+func (p *CompiledJSONPath) String() string {
+	var sb strings.Builder
+
+	if p.relative {
+		sb.WriteRune('@')
+	} else {
+		sb.WriteRune('$')
+	}
+
+	for i := range p.asts {
+		a := &p.asts[i]
+		afterDescent := i > 0 && p.asts[i-1].typ == astType_RecursiveDescent
+
+		switch a.typ {
+		case astType_NameIndexer:
+			if isBareName(a.name) {
+				if !afterDescent {
+					sb.WriteRune('.')
+				}
+				sb.WriteString(a.name)
+			} else {
+				sb.WriteRune('[')
+				writeQuotedString(&sb, a.name)
+				sb.WriteRune(']')
+			}
+		case astType_NumberIndexer:
+			sb.WriteRune('[')
+			sb.WriteString(strconv.Itoa(a.index))
+			sb.WriteRune(']')
+		case astType_Function:
+			if !afterDescent {
+				sb.WriteRune('.')
+			}
+			sb.WriteRune('(')
+			sb.WriteString(a.name)
+			for _, arg := range a.args {
+				sb.WriteRune(' ')
+				writeLiteral(&sb, arg)
+			}
+			if a.filter != nil {
+				sb.WriteRune(' ')
+				a.filter.writeTo(&sb, 0)
+			}
+			sb.WriteRune(')')
+		case astType_RecursiveDescent:
+			sb.WriteString("..")
+		case astType_Wildcard:
+			if !afterDescent {
+				sb.WriteRune('.')
+			}
+			sb.WriteRune('*')
+		case astType_Union:
+			sb.WriteRune('[')
+			for j, arg := range a.args {
+				if j > 0 {
+					sb.WriteRune(',')
+				}
+				switch z := arg.(type) {
+				case string:
+					writeQuotedString(&sb, z)
+				case int:
+					sb.WriteString(strconv.Itoa(z))
+				}
+			}
+			sb.WriteRune(']')
+		case astType_Slice:
+			sb.WriteRune('[')
+			if n, ok := a.args[0].(int); ok {
+				sb.WriteString(strconv.Itoa(n))
+			}
+			sb.WriteRune(':')
+			if n, ok := a.args[1].(int); ok {
+				sb.WriteString(strconv.Itoa(n))
+			}
+			sb.WriteRune(']')
+		case astType_Filter:
+			sb.WriteString("[?(")
+			a.filter.writeTo(&sb, 0)
+			sb.WriteString(")]")
+		}
+	}
+
+	return sb.String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+// It returns the canonical form of the path.
+// NOTE: The compile options are not a part of the text form; use MarshalBinary to keep them.
+func (p CompiledJSONPath) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// It compiles the path from the text with the default options.
+func (p *CompiledJSONPath) UnmarshalText(text []byte) error {
+	compiled, err := CompileBytes(text)
+	if err != nil {
+		return err
+	}
+	*p = *compiled
+	return nil
+}
+
+// Equal reports whether the paths are equivalent (i.e. have the same canonical form and options).
+func (p *CompiledJSONPath) Equal(q *CompiledJSONPath) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return p.opts == q.opts && p.String() == q.String()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The first byte is the format version. Unlike MarshalText, the compile options are kept.
+func (p CompiledJSONPath) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 64)
+
+	var flags byte
+	if p.relative {
+		flags |= binaryFlag_Relative
+	}
+	if p.opts.CaseInsensitive {
+		flags |= binaryFlag_CaseInsensitive
+	}
+	if p.opts.AutoMapArrays {
+		flags |= binaryFlag_AutoMapArrays
+	}
+	if p.opts.DisableWildcards {
+		flags |= binaryFlag_DisableWildcards
+	}
+	if p.opts.ExtendedBareNames {
+		flags |= binaryFlag_ExtendedBareNames
+	}
+	if p.opts.StrictEscapes {
+		flags |= binaryFlag_StrictEscapes
+	}
+	if p.opts.LenientIndex {
+		flags |= binaryFlag_LenientIndex
+	}
+	buf = append(buf, binaryFormatVersion, flags)
+	buf = appendUvarint(buf, uint64(len(p.asts)))
+
+	for i := range p.asts {
+		a := &p.asts[i]
+		buf = append(buf, byte(a.typ))
+
+		switch a.typ {
+		case astType_NameIndexer:
+			buf = appendBinaryString(buf, a.name)
+		case astType_NumberIndexer:
+			buf = appendVarint(buf, int64(a.index))
+		case astType_Function:
+			buf = appendBinaryString(buf, a.name)
+			buf = appendUvarint(buf, uint64(len(a.args)))
+			for _, arg := range a.args {
+				buf = appendBinaryArg(buf, arg)
+			}
+			if a.filter != nil {
+				buf = append(buf, 1)
+				buf = appendBinaryFilter(buf, a.filter)
+			} else {
+				buf = append(buf, 0)
+			}
+		case astType_Filter:
+			buf = appendBinaryFilter(buf, a.filter)
+		case astType_Union:
+			buf = appendUvarint(buf, uint64(len(a.args)))
+			for _, arg := range a.args {
+				buf = appendBinaryArg(buf, arg)
+			}
+		case astType_Slice:
+			buf = appendBinaryArg(buf, a.args[0])
+			buf = appendBinaryArg(buf, a.args[1])
+		}
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (p *CompiledJSONPath) UnmarshalBinary(data []byte) error {
+	r := binaryReader{data: data}
+
+	if r.byte() != binaryFormatVersion {
+		return errors.New("UnmarshalBinary: Unsupported format version")
+	}
+	flags := r.byte()
+
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(data)) {
+		return errors.New("UnmarshalBinary: Bad data")
+	}
+	asts := make([]ast, 0, n)
+
+	for k := uint64(0); k < n && r.err == nil; k++ {
+		a := ast{
+			typ: astType(r.byte()),
+		}
+
+		switch a.typ {
+		case astType_NameIndexer:
+			a.name = r.string()
+		case astType_NumberIndexer:
+			a.index = int(r.varint())
+		case astType_Function:
+			a.name = r.string()
+			argc := r.uvarint()
+			if argc > uint64(len(data)) {
+				return errors.New("UnmarshalBinary: Bad data")
+			}
+			for j := uint64(0); j < argc && r.err == nil; j++ {
+				a.args = append(a.args, r.arg())
+			}
+			if r.byte() == 1 {
+				a.filter = r.filter()
+			}
+			if r.err == nil {
+				if err := checkFunction(&a); err != nil {
+					return errors.New("UnmarshalBinary: " + err.Error())
+				}
+			}
+		case astType_RecursiveDescent, astType_Wildcard:
+		case astType_Filter:
+			a.filter = r.filter()
+		case astType_Union:
+			argc := r.uvarint()
+			if argc < 2 || argc > uint64(len(data)) {
+				return errors.New("UnmarshalBinary: Bad data")
+			}
+			for j := uint64(0); j < argc && r.err == nil; j++ {
+				a.args = append(a.args, r.arg())
+			}
+			if r.err == nil && !isValidUnion(a.args) {
+				return errors.New("UnmarshalBinary: Bad union members")
+			}
+		case astType_Slice:
+			a.args = []interface{}{r.arg(), r.arg()}
+			for _, arg := range a.args {
+				switch arg.(type) {
+				case nil, int:
+				default:
+					return errors.New("UnmarshalBinary: Bad slice bounds")
+				}
+			}
+		default:
+			return errors.New("UnmarshalBinary: Unknown segment type")
+		}
+		asts = append(asts, a)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(data) {
+		return errors.New("UnmarshalBinary: Unexpected trailing data")
+	}
+
+	*p = CompiledJSONPath{
+		asts:     asts,
+		multi:    isMultiValued(asts),
+		relative: flags&binaryFlag_Relative != 0,
+		fast:     newFastAccessor(asts),
+		opts: CompileOptions{
+			CaseInsensitive:   flags&binaryFlag_CaseInsensitive != 0,
+			AutoMapArrays:     flags&binaryFlag_AutoMapArrays != 0,
+			DisableWildcards:  flags&binaryFlag_DisableWildcards != 0,
+			ExtendedBareNames: flags&binaryFlag_ExtendedBareNames != 0,
+			StrictEscapes:     flags&binaryFlag_StrictEscapes != 0,
+			LenientIndex:      flags&binaryFlag_LenientIndex != 0,
+		},
+	}
+	return nil
+}
+
+func isValidUnion(members []interface{}) bool {
+	_, isName := members[0].(string)
+	for _, m := range members {
+		switch m.(type) {
+		case string:
+			if !isName {
+				return false
+			}
+		case int:
+			if isName {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendBinaryString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBinaryArg(buf []byte, v interface{}) []byte {
+	switch z := v.(type) {
+	case bool:
+		if z {
+			return append(buf, binaryArg_True)
+		}
+		return append(buf, binaryArg_False)
+	case float64:
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(z))
+		return append(append(buf, binaryArg_Number), tmp[:]...)
+	case string:
+		return appendBinaryString(append(buf, binaryArg_String), z)
+	case int:
+		return appendVarint(append(buf, binaryArg_Int), int64(z))
+	}
+	return append(buf, binaryArg_Null)
+}
+
+// NOTE: Filter expressions are stored in the canonical form, and parsed again on unmarshalling.
+func appendBinaryFilter(buf []byte, e *filterExpr) []byte {
+	var sb strings.Builder
+	e.writeTo(&sb, 0)
+	return appendBinaryString(buf, sb.String())
+}
+
+// The first error is kept; subsequent reads return zero values.
+type binaryReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *binaryReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("UnmarshalBinary: Unexpected end of data")
+	}
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil || r.pos >= len(r.data) {
+		r.fail()
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.data)-r.pos) {
+		r.fail()
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s
+}
+
+func (r *binaryReader) arg() interface{} {
+	switch r.byte() {
+	case binaryArg_Null:
+		return nil
+	case binaryArg_False:
+		return false
+	case binaryArg_True:
+		return true
+	case binaryArg_Number:
+		if r.err != nil || len(r.data)-r.pos < 8 {
+			r.fail()
+			return nil
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return v
+	case binaryArg_String:
+		return r.string()
+	case binaryArg_Int:
+		return int(r.varint())
+	}
+	if r.err == nil {
+		r.err = errors.New("UnmarshalBinary: Unknown argument type")
+	}
+	return nil
+}
+
+func (r *binaryReader) filter() *filterExpr {
+	s := r.string()
+	if r.err != nil {
+		return nil
+	}
+	src := []rune(s)
+	e, end, err := parseFilterExpr(src, 0, CompileOptions{})
+	if err != nil || end != len(src) {
+		r.err = errors.New("UnmarshalBinary: Bad filter expression")
+		return nil
+	}
+	return e
+}
+
+// MarshalStable returns the JSON of the whole document.
+// Object keys are sorted recursively (also in the objects in arrays),
+// so that the equal documents produce identical bytes.
+func (p parsedJSON) MarshalStable() ([]byte, error) {
+	if p.ordered {
+		return json.Marshal(plainValue(p.value))
+	}
+	return json.Marshal(p.value)
+}
+
+// MarshalStableIndent is like MarshalStable but applies the indent (see json.MarshalIndent).
+func (p parsedJSON) MarshalStableIndent(prefix, indent string) ([]byte, error) {
+	if p.ordered {
+		return json.MarshalIndent(plainValue(p.value), prefix, indent)
+	}
+	return json.MarshalIndent(p.value, prefix, indent)
+}
+
+func isBareName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if !isBareNameRune(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeQuotedString(sb *strings.Builder, s string) {
+	sb.WriteRune('\'')
+	for _, ch := range s {
+		switch ch {
+		case '\\', '\'':
+			sb.WriteRune('\\')
+			sb.WriteRune(ch)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\v':
+			sb.WriteString(`\v`)
+		default:
+			if unicode.IsControl(ch) {
+				sb.WriteString(`\u{`)
+				sb.WriteString(strconv.FormatInt(int64(ch), 16))
+				sb.WriteRune('}')
+			} else {
+				sb.WriteRune(ch)
+			}
+		}
+	}
+	sb.WriteRune('\'')
+}
+
+func writeLiteral(sb *strings.Builder, v interface{}) {
+	switch z := v.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		sb.WriteString(strconv.FormatBool(z))
+	case float64:
+		sb.WriteString(strconv.FormatFloat(z, 'g', -1, 64))
+	case string:
+		writeQuotedString(sb, z)
+	}
+}
+
+func (o *filterOperand) writeTo(sb *strings.Builder) {
+	if o.path != nil {
+		sb.WriteString(o.path.String())
+	} else {
+		writeLiteral(sb, o.value)
+	}
+}
+
+// prec is the precedence of the enclosing expression (0: none, 1: '||', 2: '&&', 3: '!').
+// Parentheses are written if the expression binds weaker than the enclosing one.
+func (e *filterExpr) writeTo(sb *strings.Builder, prec int) {
+	switch e.op {
+	case filterOp_Or, filterOp_And:
+		op, myPrec := " || ", 1
+		if e.op == filterOp_And {
+			op, myPrec = " && ", 2
+		}
+		if myPrec < prec {
+			sb.WriteRune('(')
+		}
+		e.left.writeTo(sb, myPrec)
+		sb.WriteString(op)
+		e.right.writeTo(sb, myPrec)
+		if myPrec < prec {
+			sb.WriteRune(')')
+		}
+	case filterOp_Not:
+		sb.WriteRune('!')
+		e.left.writeTo(sb, 3)
+	case filterOp_Exists:
+		e.lhs.writeTo(sb)
+	case filterOp_Compare:
+		if prec == 3 {
+			sb.WriteRune('(')
+		}
+		e.lhs.writeTo(sb)
+		sb.WriteRune(' ')
+		sb.WriteString(e.cmp)
+		sb.WriteRune(' ')
+		e.rhs.writeTo(sb)
+		if prec == 3 {
+			sb.WriteRune(')')
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package jsonpath_test
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{{
+		name: "1",
+		path: `$`,
+		want: `$`,
+	}, {
+		name: "2",
+		path: `$ . foo [ 'bar' ] [ 1 ]`,
+		want: `$.foo.bar[1]`,
+	}, {
+		name: "3",
+		path: `$["a b"]["it's"]['\t\u{1}']`,
+		want: `$['a b']['it\'s']['\t\u{1}']`,
+	}, {
+		name: "4",
+		path: `$.foo.( coalesceKeys "a"  'b' ).(take 2.00).(chunk 1e3)`,
+		want: `$.foo.(coalesceKeys 'a' 'b').(take 2).(chunk 1000)`,
+	}, {
+		name: "5",
+		path: `$..foo..['a b']..[0]..(length)`,
+		want: `$..foo..['a b']..[0]..(length)`,
+	}, {
+		name: "6",
+		path: `$[?(@.a>1&&(@.b=='x'||!@.c)&&!(@.d==null))]`,
+		want: `$[?(@.a > 1 && (@.b == 'x' || !@.c) && !(@.d == null))]`,
+	}, {
+		name: "7",
+		path: `$.items.(findIndex @['x y'] >= -2 || $.z == true)`,
+		want: `$.items.(findIndex @['x y'] >= -2 || $.z == true)`,
+	}, {
+		name: "8",
+		path: `$.日本語['']`,
+		want: `$.日本語['']`,
+	}, {
+		name: "9",
+		path: `$[?(@.min<=@.max&&@.a!=$.b[0])]`,
+		want: `$[?(@.min <= @.max && @.a != $.b[0])]`,
+	}, {
+		name: "10",
+		path: `$.a.*[*]..*..[*].b`,
+		want: `$.a.*.*..*..*.b`,
+	}, {
+		name: "11",
+		path: `$[ 'a' ,"b c"].x[ 1,0 ]`,
+		want: `$['a','b c'].x[1,0]`,
+	}, {
+		name: "12",
+		path: `$.a.(reverse)( take 2 )[0]`,
+		want: `$.a.(reverse).(take 2)[0]`,
+	}, {
+		name: "13",
+		path: `$.a[ 1 : -1 ][:2][ -3: ][:]`,
+		want: `$.a[1:-1][:2][-3:][:]`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			s := path.String()
+			if s != tt.want {
+				t.Errorf("%v: s = %v, want = %v", tt.name, s, tt.want)
+				return
+			}
+
+			path2, err := jsonpath.Compile(s)
+			if err != nil {
+				t.Errorf("%v: Compile (2): error = %v", tt.name, err)
+				return
+			}
+			if s2 := path2.String(); s2 != s {
+				t.Errorf("%v: s2 = %v, want = %v", tt.name, s2, s)
+				return
+			}
+		})
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	type config struct {
+		Name  string                       `json:"name"`
+		Path  jsonpath.CompiledJSONPath    `json:"path"`
+		Paths []*jsonpath.CompiledJSONPath `json:"paths"`
+	}
+
+	src := `{"name":"foo","path":"$ . a [ 0 ]","paths":["$.b","$..c"]}`
+
+	var cfg config
+	if err := json.Unmarshal([]byte(src), &cfg); err != nil {
+		t.Errorf("Unmarshal: error = %v", err)
+		return
+	}
+
+	doc, err := jsonpath.ReadString(`{"a":[1],"b":2,"x":{"c":3}}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	v, err := cfg.Path.Query(doc)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+	if v != float64(1) {
+		t.Errorf("v = %v, want = %v", v, 1)
+		return
+	}
+
+	v, err = cfg.Paths[1].Query(doc)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(v, []interface{}{float64(3)}) {
+		t.Errorf("v = %v, want = %v", v, []interface{}{float64(3)})
+		return
+	}
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Errorf("Marshal: error = %v", err)
+		return
+	}
+	want := `{"name":"foo","path":"$.a[0]","paths":["$.b","$..c"]}`
+	if string(b) != want {
+		t.Errorf("b = %v, want = %v", string(b), want)
+		return
+	}
+
+	var cfg2 config
+	if err := json.Unmarshal(b, &cfg2); err != nil {
+		t.Errorf("Unmarshal (2): error = %v", err)
+		return
+	}
+	if cfg2.Path.String() != cfg.Path.String() {
+		t.Errorf("path = %v, want = %v", cfg2.Path.String(), cfg.Path.String())
+		return
+	}
+
+	if err := json.Unmarshal([]byte(`{"path":"$.a["}`), &cfg2); err == nil {
+		t.Errorf("Unmarshal: want error")
+		return
+	}
+
+	// The compile options are not kept in the text form.
+	path1, _ := jsonpath.CompileWithOptions(`$.A`, jsonpath.CompileOptions{CaseInsensitive: true})
+	if v, err := path1.Query(doc); err != nil || !reflect.DeepEqual(v, []interface{}{float64(1)}) {
+		t.Errorf("Query: v = %v, error = %v", v, err)
+		return
+	}
+	text, _ := path1.MarshalText()
+	var path2 jsonpath.CompiledJSONPath
+	if err := path2.UnmarshalText(text); err != nil {
+		t.Errorf("UnmarshalText: error = %v", err)
+		return
+	}
+	if _, err := path2.Query(doc); err == nil {
+		t.Errorf("Query: want error (the options are not restored)")
+	}
+	if path2.Equal(path1) {
+		t.Errorf("Equal: want false")
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{{
+		name: "1",
+		path: `$`,
+	}, {
+		name: "2",
+		path: `$.foo['a b'][1][20000]`,
+	}, {
+		name: "3",
+		path: `$.foo.(coalesceKeys 'a' "b").(take 2).(chunk 1e3)`,
+	}, {
+		name: "4",
+		path: `$..foo..[0].*[*]`,
+	}, {
+		name: "5",
+		path: `$.items[?(@.a > 1 && (@.b == 'x' || !@.c) && @.d != null && @.e == $.f)].g`,
+	}, {
+		name: "6",
+		path: `$.items.(findIndex @['x y'] >= -2.5 || $.z == true)`,
+	}, {
+		name: "7",
+		path: `$.a.(startsWithArr '$.b[0]')`,
+	}, {
+		name: "8",
+		path: `$['a','b'].c[3,1,2]`,
+	}, {
+		name: "9",
+		path: `$.a[1:-1][:2][-3:][:]`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			var m encoding.BinaryMarshaler = path
+			b, err := m.MarshalBinary()
+			if err != nil {
+				t.Errorf("%v: MarshalBinary: error = %v", tt.name, err)
+				return
+			}
+
+			var path2 jsonpath.CompiledJSONPath
+			var u encoding.BinaryUnmarshaler = &path2
+			if err := u.UnmarshalBinary(b); err != nil {
+				t.Errorf("%v: UnmarshalBinary: error = %v", tt.name, err)
+				return
+			}
+			if !path.Equal(&path2) {
+				t.Errorf("%v: path2 = %v, want = %v", tt.name, path2.String(), path.String())
+				return
+			}
+
+			// Truncated data is an error.
+			for i := 0; i < len(b); i++ {
+				var path3 jsonpath.CompiledJSONPath
+				if err := path3.UnmarshalBinary(b[:i]); err == nil {
+					t.Errorf("%v: UnmarshalBinary (truncated at %v): want error", tt.name, i)
+					return
+				}
+			}
+		})
+	}
+
+	opts := jsonpath.CompileOptions{CaseInsensitive: true, AutoMapArrays: true, DisableWildcards: true, ExtendedBareNames: true, StrictEscapes: true, LenientIndex: true}
+	path1, err := jsonpath.CompileWithOptions(`$.a`, opts)
+	if err != nil {
+		t.Errorf("CompileWithOptions: error = %v", err)
+		return
+	}
+	b, err := path1.MarshalBinary()
+	if err != nil {
+		t.Errorf("MarshalBinary: error = %v", err)
+		return
+	}
+	var path jsonpath.CompiledJSONPath
+	if err := path.UnmarshalBinary(b); err != nil {
+		t.Errorf("UnmarshalBinary: error = %v", err)
+		return
+	}
+	if !path.Equal(path1) {
+		t.Errorf("UnmarshalBinary: options are not restored")
+	}
+	if path2, _ := jsonpath.Compile(`$.a`); path2.Equal(path1) {
+		t.Errorf("Equal: options are not compared")
+	}
+
+	if err := path.UnmarshalBinary([]byte{99, 0, 0}); err == nil {
+		t.Errorf("UnmarshalBinary (bad version): want error")
+	}
+	if err := path.UnmarshalBinary([]byte{1, 0, 1, 99}); err == nil {
+		t.Errorf("UnmarshalBinary (bad segment type): want error")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		x    string
+		y    string
+		want bool
+	}{{
+		name: "1",
+		x:    `$.a['b'][0]`,
+		y:    `$ . a . b [ 0 ]`,
+		want: true,
+	}, {
+		name: "2",
+		x:    `$.a.b`,
+		y:    `$.a.c`,
+		want: false,
+	}, {
+		name: "3",
+		x:    `$[?(@.a>1)]`,
+		y:    `$[?( @.a > 1.0 )]`,
+		want: true,
+	}, {
+		name: "4",
+		x:    `$.a[0]`,
+		y:    `$.a['0']`,
+		want: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := jsonpath.Compile(tt.x)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			y, err := jsonpath.Compile(tt.y)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			if eq := x.Equal(y); eq != tt.want {
+				t.Errorf("%v: Equal = %v, want = %v", tt.name, eq, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestMarshalStable(t *testing.T) {
+	x, err := jsonpath.ReadString(`{"b":[{"y":1,"x":2},{"d":{"f":1,"e":2}}],"a":"s","c":null}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+	y, err := jsonpath.ReadString(`{"c":null,"a":"s","b":[{"x":2.0,"y":1},{"d":{"e":2,"f":1e0}}]}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	bx, err := x.MarshalStable()
+	if err != nil {
+		t.Errorf("MarshalStable: error = %v", err)
+		return
+	}
+	by, err := y.MarshalStable()
+	if err != nil {
+		t.Errorf("MarshalStable: error = %v", err)
+		return
+	}
+	want := `{"a":"s","b":[{"x":2,"y":1},{"d":{"e":2,"f":1}}],"c":null}`
+	if string(bx) != want || string(by) != want {
+		t.Errorf("bx = %v, by = %v, want = %v", string(bx), string(by), want)
+		return
+	}
+
+	bx, err = x.MarshalStableIndent("", "\t")
+	if err != nil {
+		t.Errorf("MarshalStableIndent: error = %v", err)
+		return
+	}
+	by, err = y.MarshalStableIndent("", "\t")
+	if err != nil {
+		t.Errorf("MarshalStableIndent: error = %v", err)
+		return
+	}
+	want = "{\n\t\"a\": \"s\",\n\t\"b\": [\n\t\t{\n\t\t\t\"x\": 2,\n\t\t\t\"y\": 1\n\t\t},\n\t\t{\n\t\t\t\"d\": {\n\t\t\t\t\"e\": 2,\n\t\t\t\t\"f\": 1\n\t\t\t}\n\t\t}\n\t],\n\t\"c\": null\n}"
+	if string(bx) != want || string(by) != want {
+		t.Errorf("bx = %v, by = %v, want = %v", string(bx), string(by), want)
+		return
+	}
+}
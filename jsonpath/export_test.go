@@ -0,0 +1,8 @@
+package jsonpath
+
+// WithoutFastPath returns a copy of the path that always uses the generic interpreter.
+func WithoutFastPath(p *CompiledJSONPath) *CompiledJSONPath {
+	q := *p
+	q.fast = nil
+	return &q
+}
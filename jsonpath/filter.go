@@ -0,0 +1,471 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode"
+)
+
+type filterOp int
+
+const (
+	filterOp_Or filterOp = iota + 1
+	filterOp_And
+	filterOp_Not
+	filterOp_Exists
+	filterOp_Compare
+)
+
+type filterOperand struct {
+	path  *CompiledJSONPath
+	value interface{}
+}
+
+type filterExpr struct {
+	op    filterOp
+	left  *filterExpr
+	right *filterExpr
+	cmp   string
+	lhs   filterOperand
+	rhs   filterOperand
+}
+
+// Filter expression:
+//
+//	or         = and ('||' and)*
+//	and        = not ('&&' not)*
+//	not        = '!' not | '(' or ')' | comparison
+//	comparison = path (op (path | literal))?
+//	path       = '@' ... (relative to the current item) | '$' ... (relative to the root)
+//	op         = '==' | '!=' | '<' | '<=' | '>' | '>='
+//	literal    = quoted string | number | true | false | null
+//
+// Spaces and `/* ... */` comments are allowed between the tokens.
+func parseFilterExpr(src []rune, start int, opts CompileOptions) (*filterExpr, int, error) {
+	return parseFilterOr(src, start, opts)
+}
+
+func parseFilterOr(src []rune, start int, opts CompileOptions) (*filterExpr, int, error) {
+	left, end, err := parseFilterAnd(src, start, opts)
+	if err != nil {
+		return nil, start, err
+	}
+
+	for {
+		end = skipFilterSpaces(src, end)
+		if !hasPrefixAt(src, end, "||") {
+			return left, end, nil
+		}
+
+		var right *filterExpr
+		right, end, err = parseFilterAnd(src, end+2, opts)
+		if err != nil {
+			return nil, start, err
+		}
+		left = &filterExpr{
+			op:    filterOp_Or,
+			left:  left,
+			right: right,
+		}
+	}
+}
+
+func parseFilterAnd(src []rune, start int, opts CompileOptions) (*filterExpr, int, error) {
+	left, end, err := parseFilterNot(src, start, opts)
+	if err != nil {
+		return nil, start, err
+	}
+
+	for {
+		end = skipFilterSpaces(src, end)
+		if !hasPrefixAt(src, end, "&&") {
+			return left, end, nil
+		}
+
+		var right *filterExpr
+		right, end, err = parseFilterNot(src, end+2, opts)
+		if err != nil {
+			return nil, start, err
+		}
+		left = &filterExpr{
+			op:    filterOp_And,
+			left:  left,
+			right: right,
+		}
+	}
+}
+
+func parseFilterNot(src []rune, start int, opts CompileOptions) (*filterExpr, int, error) {
+	length := len(src)
+
+	i := skipFilterSpaces(src, start)
+	if i == length {
+		return nil, start, newPathError(i, "compileCore: Unexpected termination in the filter: Pos=%v", i)
+	}
+
+	switch src[i] {
+	case '!':
+		operand, end, err := parseFilterNot(src, i+1, opts)
+		if err != nil {
+			return nil, start, err
+		}
+		return &filterExpr{
+			op:   filterOp_Not,
+			left: operand,
+		}, end, nil
+
+	case '(':
+		expr, end, err := parseFilterOr(src, i+1, opts)
+		if err != nil {
+			return nil, start, err
+		}
+		if end == length || src[end] != ')' {
+			return nil, start, newPathError(i, "compileCore: '(' parenthesis is not closed in the filter: Pos=%v, %v", i, string(src[i:]))
+		}
+		return expr, end + 1, nil
+	}
+
+	return parseFilterComparison(src, i, opts)
+}
+
+func parseFilterComparison(src []rune, start int, opts CompileOptions) (*filterExpr, int, error) {
+	lhs, end, err := parseFilterPathOperand(src, start, opts)
+	if err != nil {
+		return nil, start, err
+	}
+
+	i := skipFilterSpaces(src, end)
+	cmp := ""
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if hasPrefixAt(src, i, op) {
+			cmp = op
+			break
+		}
+	}
+	if cmp == "" {
+		return &filterExpr{
+			op:  filterOp_Exists,
+			lhs: lhs,
+		}, end, nil
+	}
+
+	var rhs filterOperand
+	if j := skipFilterSpaces(src, i+len(cmp)); j < len(src) && (src[j] == '@' || src[j] == '$') {
+		rhs, end, err = parseFilterPathOperand(src, j, opts)
+	} else {
+		rhs, end, err = parseFilterLiteralOperand(src, i+len(cmp), opts)
+	}
+	if err != nil {
+		return nil, start, err
+	}
+
+	return &filterExpr{
+		op:  filterOp_Compare,
+		cmp: cmp,
+		lhs: lhs,
+		rhs: rhs,
+	}, end, nil
+}
+
+func parseFilterPathOperand(src []rune, start int, opts CompileOptions) (filterOperand, int, error) {
+	length := len(src)
+
+	i := skipFilterSpaces(src, start)
+	if i == length {
+		return filterOperand{}, start, newPathError(i, "compileCore: Unexpected termination in the filter: Pos=%v", i)
+	}
+	if src[i] != '@' && src[i] != '$' {
+		return filterOperand{}, start, newPathError(i, "compileCore: Path is expected in the filter: Pos=%v, %v", i, string(src[i:]))
+	}
+
+	end := scanFilterPathOperand(src, i)
+
+	path, err := compileCore(src[i:end], src[i], opts)
+	if err != nil {
+		pos := i
+		var pe *PathError
+		if errors.As(err, &pe) {
+			pos += pe.Pos
+		}
+		return filterOperand{}, start, newPathError(pos, "compileCore: Bad path in the filter: Pos=%v, %v", pos, err)
+	}
+	if path.multi {
+		return filterOperand{}, start, newPathError(i, "compileCore: Multi-valued path cannot be used in the filter: Pos=%v, %v", i, string(src[i:end]))
+	}
+
+	return filterOperand{
+		path: path,
+	}, end, nil
+}
+
+// Returns the end of the path operand.
+// The operand ends with a space, a comment, an operator or an unmatched closing parenthesis.
+func scanFilterPathOperand(src []rune, start int) int {
+	length := len(src)
+	depth := 0
+
+	for i := start; i < length; i++ {
+		ch := src[i]
+		switch ch {
+		case '\'', '"':
+			// NOTE: The escapes are checked when the path is parsed.
+			_, end, err := parseQuotedName(src, ch, i+1, CompileOptions{})
+			if err != nil {
+				return i
+			}
+			i = end - 1
+		case '[', '(':
+			depth++
+		case ']', ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '=', '!', '<', '>', '&', '|':
+			if depth == 0 {
+				return i
+			}
+		case '/':
+			if depth == 0 && hasPrefixAt(src, i, "/*") {
+				return i
+			}
+		default:
+			if depth == 0 && (unicode.IsSpace(ch) || unicode.IsControl(ch)) {
+				return i
+			}
+		}
+	}
+	return length
+}
+
+func parseFilterLiteralOperand(src []rune, start int, opts CompileOptions) (filterOperand, int, error) {
+	length := len(src)
+
+	i := skipFilterSpaces(src, start)
+	if i == length {
+		return filterOperand{}, start, newPathError(i, "compileCore: Unexpected termination in the filter: Pos=%v", i)
+	}
+
+	ch := src[i]
+	switch {
+	case ch == '\'' || ch == '"':
+		s, end, err := parseQuotedName(src, ch, i+1, opts)
+		if err != nil {
+			return filterOperand{}, start, newPathError(i, "compileCore: Bad quoted string in the filter: Pos=%v, %v", i, string(src[i:]))
+		}
+		return filterOperand{value: s}, end, nil
+
+	case '0' <= ch && ch <= '9' || ch == '-':
+		end, err := parseFloatNumber(src, i)
+		if err != nil {
+			return filterOperand{}, start, newPathError(i, "compileCore: Bad number in the filter: Pos=%v, %v", i, string(src[i:]))
+		}
+		num, err := strconv.ParseFloat(string(src[i:end]), 64)
+		if err != nil {
+			return filterOperand{}, start, newPathError(i, "compileCore: Number cannot be parsed: Pos=%v, %v", i, string(src[i:end]))
+		}
+		return filterOperand{value: num}, end, nil
+	}
+
+	for _, kw := range []struct {
+		name  string
+		value interface{}
+	}{{"true", true}, {"false", false}, {"null", nil}} {
+		end := i + len(kw.name)
+		if hasPrefixAt(src, i, kw.name) && (end == length || !isBareNameRune(src[end])) {
+			return filterOperand{value: kw.value}, end, nil
+		}
+	}
+
+	return filterOperand{}, start, newPathError(i, "compileCore: Literal is expected in the filter: Pos=%v, %v", i, string(src[i:]))
+}
+
+// Skips spaces and `/* ... */` comments.
+// An unterminated comment is not skipped (it is reported as an unexpected character).
+func skipFilterSpaces(src []rune, start int) int {
+	length := len(src)
+	i := start
+
+	for i < length {
+		i, _ = skipSpaces(src, i)
+		if !hasPrefixAt(src, i, "/*") {
+			break
+		}
+		end := -1
+		for j := i + 2; j+1 < length; j++ {
+			if src[j] == '*' && src[j+1] == '/' {
+				end = j + 2
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		i = end
+	}
+	return i
+}
+
+func hasPrefixAt(src []rune, start int, prefix string) bool {
+	i := start
+	for _, ch := range prefix {
+		if i >= len(src) || src[i] != ch {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// Returns the value of the operand. ok is false if the path does not match.
+func (o *filterOperand) resolve(c *queryContext, v interface{}) (interface{}, bool) {
+	if o.path == nil {
+		return o.value, true
+	}
+
+	base := v
+	if !o.path.relative {
+		base = c.root
+	}
+	w, err := o.path.query(c, base)
+	if err != nil {
+		return nil, false
+	}
+	return w, true
+}
+
+func (e *filterExpr) eval(c *queryContext, v interface{}) bool {
+	switch e.op {
+	case filterOp_Or:
+		return e.left.eval(c, v) || e.right.eval(c, v)
+	case filterOp_And:
+		return e.left.eval(c, v) && e.right.eval(c, v)
+	case filterOp_Not:
+		return !e.left.eval(c, v)
+	case filterOp_Exists:
+		_, ok := e.lhs.resolve(c, v)
+		return ok
+	case filterOp_Compare:
+		x, ok := e.lhs.resolve(c, v)
+		if !ok {
+			return false
+		}
+		y, ok := e.rhs.resolve(c, v)
+		if !ok {
+			return false
+		}
+		return compareValues(e.cmp, x, y)
+	}
+	return false
+}
+
+// Calls fn for each path of the operands. It stops at the first error.
+func (e *filterExpr) walkPaths(fn func(p *CompiledJSONPath) error) error {
+	if e == nil {
+		return nil
+	}
+	if err := e.left.walkPaths(fn); err != nil {
+		return err
+	}
+	if err := e.right.walkPaths(fn); err != nil {
+		return err
+	}
+	for _, o := range []*filterOperand{&e.lhs, &e.rhs} {
+		if o.path != nil {
+			if err := fn(o.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns a deep copy of the expression with the root-relative paths prefixed.
+func (e *filterExpr) rebased(segments []string) *filterExpr {
+	if e == nil {
+		return nil
+	}
+	ret := *e
+	ret.left = e.left.rebased(segments)
+	ret.right = e.right.rebased(segments)
+	if e.lhs.path != nil {
+		ret.lhs.path = e.lhs.path.rebased(segments)
+	}
+	if e.rhs.path != nil {
+		ret.rhs.path = e.rhs.path.rebased(segments)
+	}
+	return &ret
+}
+
+// NOTE: Numbers and strings are ordered. Other types are only compared for equality.
+// Values of different types are not equal.
+// Any comparison with NaN (including `!=`) is false.
+func compareValues(cmp string, x, y interface{}) bool {
+	if xf, ok := toFloat64(x); ok {
+		if yf, ok := toFloat64(y); ok {
+			if math.IsNaN(xf) || math.IsNaN(yf) {
+				return false
+			}
+			switch cmp {
+			case "==":
+				return xf == yf
+			case "!=":
+				return xf != yf
+			case "<":
+				return xf < yf
+			case "<=":
+				return xf <= yf
+			case ">":
+				return xf > yf
+			case ">=":
+				return xf >= yf
+			}
+			return false
+		}
+	}
+
+	if xs, ok := x.(string); ok {
+		if ys, ok := y.(string); ok {
+			switch cmp {
+			case "==":
+				return xs == ys
+			case "!=":
+				return xs != ys
+			case "<":
+				return xs < ys
+			case "<=":
+				return xs <= ys
+			case ">":
+				return xs > ys
+			case ">=":
+				return xs >= ys
+			}
+			return false
+		}
+	}
+
+	switch cmp {
+	case "==":
+		return reflect.DeepEqual(x, y)
+	case "!=":
+		return !reflect.DeepEqual(x, y)
+	}
+	return false
+}
+
+// NOTE: json.Number appears in the values passed to FromAny (e.g. decoded with UseNumber).
+func toFloat64(v interface{}) (float64, bool) {
+	switch z := v.(type) {
+	case float64:
+		return z, true
+	case int:
+		return float64(z), true
+	case json.Number:
+		f, err := z.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
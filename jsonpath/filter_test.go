@@ -0,0 +1,627 @@
+package jsonpath_test
+
+import (
+	"math"
+	"reflect"
+	"runtime/debug"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+const filterTestSrc = `{
+	"type": "error",
+	"events": [
+		{"type": "error", "code": 1},
+		{"type": "info", "code": 2},
+		{"type": "error", "code": 3, "cause": {"type": "error", "code": 4}}
+	],
+	"nested": {
+		"deep": {
+			"deeper": [{"type": "error", "code": 5}, "error", 6]
+		}
+	}
+}`
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `[{"a":1},{"a":2},{"a":3}]`,
+		path:    `$[?(@.a > 1)]`,
+		want:    []interface{}{map[string]interface{}{"a": float64(2)}, map[string]interface{}{"a": float64(3)}},
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `[{"a":1},{"a":2},{"a":3}]`,
+		path:    `$[?(@.a == 2)].a`,
+		want:    []interface{}{float64(2)},
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"items":[{"a":"x"},{"b":"y"},{"a":"z"}]}`,
+		path:    `$.items[?(@.a)]`,
+		want:    []interface{}{map[string]interface{}{"a": "x"}, map[string]interface{}{"a": "z"}},
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"items":[{"a":"x"},{"b":"y"},{"a":"z"}]}`,
+		path:    `$.items[?(!@.a)]`,
+		want:    []interface{}{map[string]interface{}{"b": "y"}},
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `[{"a":1,"b":true},{"a":2,"b":false},{"a":3,"b":true}]`,
+		path:    `$[?(@.a >= 2 && @.b == true)].a`,
+		want:    []interface{}{float64(3)},
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `[{"a":1,"b":true},{"a":2,"b":false},{"a":3,"b":true}]`,
+		path:    `$[?(@.a < 2 || (@.b == false && @.a != 1))].a`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `{"limit":2,"items":[{"a":1},{"a":2},{"a":3}]}`,
+		path:    `$.items[?($.limit == 2 && @.a != 1)].a`,
+		want:    []interface{}{float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     `[{"a":null},{"a":"null"},{"a":1}]`,
+		path:    `$[?(@.a == null)]`,
+		want:    []interface{}{map[string]interface{}{"a": nil}},
+		wantErr: false,
+	}, {
+		name:    "9",
+		src:     `[{"a":1},{"a":2}]`,
+		path:    `$[?(@.a > 5)]`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "10",
+		src:     `[{"a":[1,2]},{"a":[1]}]`,
+		path:    `$[?(@.a.(length) == 2)].a[1]`,
+		want:    []interface{}{float64(2)},
+		wantErr: false,
+	}, {
+		name:    "11",
+		src:     `{"x":{"n":1},"y":{"n":2}}`,
+		path:    `$[?(@.n > 0)].n`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "12",
+		src:     filterTestSrc,
+		path:    `$..code`,
+		want:    []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)},
+		wantErr: false,
+	}, {
+		name:    "13",
+		src:     filterTestSrc,
+		path:    `$..[?(@.type == 'error')].code`,
+		want:    []interface{}{float64(1), float64(3), float64(4), float64(5)},
+		wantErr: false,
+	}, {
+		name:    "14",
+		src:     filterTestSrc,
+		path:    `$.events..[?(@.type == "error")].code`,
+		want:    []interface{}{float64(1), float64(3), float64(4)},
+		wantErr: false,
+	}, {
+		name:    "15",
+		src:     filterTestSrc,
+		path:    `$..deeper[0].code`,
+		want:    []interface{}{float64(5)},
+		wantErr: false,
+	}, {
+		name:    "16",
+		src:     `[1,2,3]`,
+		path:    `$[?(@ > 1)]`,
+		want:    []interface{}{float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "17",
+		src:     `[]`,
+		path:    `$[?(@.a ==)]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "18",
+		src:     `[]`,
+		path:    `$[?(@.a == 1]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "19",
+		src:     `[]`,
+		path:    `$[?(1 == 1)]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "20",
+		src:     `[]`,
+		path:    `$[?(@..a)]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "21",
+		src:     `[]`,
+		path:    `$..`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "22",
+		src:     `{"pairs":[{"min":1,"max":2},{"min":3,"max":2},{"min":2,"max":2}]}`,
+		path:    `$.pairs[?(@.min <= @.max)].min`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "23",
+		src:     `{"pairs":[{"min":1,"max":"1"},{"min":"a","max":"a"},{"min":1,"max":1}]}`,
+		path:    `$.pairs[?(@.min == @.max)].max`,
+		want:    []interface{}{"a", float64(1)},
+		wantErr: false,
+	}, {
+		name:    "24",
+		src:     `{"pairs":[{"min":1,"max":"1"},{"min":"a","max":"a"},{"min":1,"max":1}]}`,
+		path:    `$.pairs[?(@.min != @.max)].max`,
+		want:    []interface{}{"1"},
+		wantErr: false,
+	}, {
+		name:    "25",
+		src:     `{"pairs":[{"min":1,"max":"2"},{"min":"1","max":2}]}`,
+		path:    `$.pairs[?(@.min < @.max)]`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "26",
+		src:     `{"limit":2,"items":[{"a":1},{"a":2},{"a":3}]}`,
+		path:    `$.items[?(@.a>=$.limit)].a`,
+		want:    []interface{}{float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "27",
+		src:     `{"items":[{"a":1,"b":1},{"a":2}]}`,
+		path:    `$.items[?(@.a == @.b)].a`,
+		want:    []interface{}{float64(1)},
+		wantErr: false,
+	}, {
+		name:    "28",
+		src:     `[]`,
+		path:    `$[?(@.a == @..b)]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "29",
+		src:     `[{"x":1},{"x":6},{"x":10}]`,
+		path:    "$[ ?(   @.x  >  5   ) ].x",
+		want:    []interface{}{float64(6), float64(10)},
+		wantErr: false,
+	}, {
+		name:    "30",
+		src:     `[{"x":1},{"x":6},{"x":10}]`,
+		path:    "$[?(\n\t@.x >= 5 /* lower bound */\n\t&& /* and */ @.x < 10 /* upper bound */\n)].x",
+		want:    []interface{}{float64(6)},
+		wantErr: false,
+	}, {
+		name:    "31",
+		src:     `[{"x":1},{"x":6},{"x":10}]`,
+		path:    "$[?(/* leading */ ! /* not */ ( @.x/* c */==/* c */1 || @.x == 10 ) /* trailing */)].x",
+		want:    []interface{}{float64(6)},
+		wantErr: false,
+	}, {
+		name:    "32",
+		src:     `[{"x":1},{"x":6},{"x":10}]`,
+		path:    "$[?(@.x > 5 /* unterminated )].x",
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "33",
+		src:     `[{"x":1},{"x":6},{"x":10}]`,
+		path:    "$[?(@['/*'] /* c */)]",
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "34",
+		src:     `{"a":[1,{"type":"error","b":3}],"c":{"d":[4,"error"]},"type":"error"}`,
+		path:    `$..[?(@ > 2)]`,
+		want:    []interface{}{float64(3), float64(4)},
+		wantErr: false,
+	}, {
+		name:    "35",
+		src:     `{"a":[1,{"type":"error","b":3}],"c":{"d":[4,"error"]},"type":"error"}`,
+		path:    `$..[?(@.type == 'error')]`,
+		want:    []interface{}{map[string]interface{}{"type": "error", "b": float64(3)}},
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				var v interface{}
+				v, err = path.Query(json)
+				if err == nil {
+					if tt.wantErr {
+						t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+						return
+					}
+					if !reflect.DeepEqual(v, tt.want) {
+						t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					}
+					return
+				}
+			}
+
+			if !tt.wantErr {
+				t.Errorf("%v: error = %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestQueryAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    []interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"a":1}`,
+		path:    `$.a`,
+		want:    []interface{}{float64(1)},
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":1}`,
+		path:    `$.b`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "3",
+		src:     `{"a":{"b":1},"c":[{"b":2}]}`,
+		path:    `$..b`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.QueryAll(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: QueryAll: want error: v = %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: QueryAll: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestQueryAllDistinct(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    []interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"a":{"type":"x","b":[{"type":"y"},{"type":"x"}]},"c":[{"type":"y"},{"type":null},{"type":null}]}`,
+		path:    `$..type`,
+		want:    []interface{}{"x", "y", nil},
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":[1,"1",1.0,true,2,true]}`,
+		path:    `$.a[*]`,
+		want:    []interface{}{float64(1), "1", true, float64(2)},
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"a":[{"k":1},{"k":1},[1],[1],1]}`,
+		path:    `$.a.*`,
+		want:    []interface{}{map[string]interface{}{"k": float64(1)}, map[string]interface{}{"k": float64(1)}, []interface{}{float64(1)}, []interface{}{float64(1)}, float64(1)},
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"a":1}`,
+		path:    `$.a`,
+		want:    []interface{}{float64(1)},
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `{"a":1}`,
+		path:    `$.b`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "6",
+		src:     `{"a":1}`,
+		path:    `$.b[*]`,
+		want:    []interface{}{},
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.QueryAllDistinct(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: QueryAllDistinct: want error: v = %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: QueryAllDistinct: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestDeepRecursiveDescent(t *testing.T) {
+	const depth = 100000
+
+	var doc interface{} = map[string]interface{}{"leaf": float64(depth)}
+	for i := depth - 1; i >= 0; i-- {
+		doc = map[string]interface{}{
+			"child": []interface{}{doc},
+			"leaf":  float64(i),
+		}
+	}
+
+	json, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	path, err := jsonpath.Compile(`$..leaf`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	// NOTE: A naive recursive walker overflows this stack limit.
+	prev := debug.SetMaxStack(1 << 20)
+	defer debug.SetMaxStack(prev)
+
+	v, err := path.QueryAll(json)
+	if err != nil {
+		t.Errorf("QueryAll: error = %v", err)
+		return
+	}
+
+	if len(v) != depth+1 {
+		t.Errorf("len(v) = %v, want = %v", len(v), depth+1)
+		return
+	}
+	for i, w := range v {
+		if w != float64(i) {
+			t.Errorf("v[%v] = %v, want = %v", i, w, i)
+			return
+		}
+	}
+}
+
+func TestNaN(t *testing.T) {
+	doc := map[string]interface{}{
+		"values": []interface{}{float64(1), math.NaN(), float64(3)},
+		"items": []interface{}{
+			map[string]interface{}{"x": float64(2)},
+			map[string]interface{}{"x": math.NaN()},
+			map[string]interface{}{"x": float64(0)},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		want  interface{}
+		isNaN bool
+	}{{
+		name:  "1",
+		path:  `$.values.(min)`,
+		isNaN: true,
+	}, {
+		name:  "2",
+		path:  `$.values.(max)`,
+		isNaN: true,
+	}, {
+		name: "3",
+		path: `$.items[?(@.x > 1)].x`,
+		want: []interface{}{float64(2)},
+	}, {
+		name: "4",
+		path: `$.items[?(@.x <= 1)].x`,
+		want: []interface{}{float64(0)},
+	}, {
+		name: "5",
+		path: `$.items[?(@.x != 2)].x`,
+		want: []interface{}{float64(0)},
+	}, {
+		name: "6",
+		path: `$.items[?(@.x == 2 || @.x != 2)].x`,
+		want: []interface{}{float64(2), float64(0)},
+	}, {
+		name: "7",
+		path: `$.items[?(!(@.x == 2 || @.x != 2))].x.(toBool)`,
+		want: []interface{}{true},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.FromAny(doc)
+			if err != nil {
+				t.Errorf("%v: FromAny: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if tt.isNaN {
+				if f, ok := v.(float64); !ok || !math.IsNaN(f) {
+					t.Errorf("%v: v = %v, want = NaN", tt.name, v)
+				}
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"obj":{"b":2,"a":1,"c":3}}`,
+		path:    `$.obj.*`,
+		want:    []interface{}{float64(1), float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"arr":[3,1,2]}`,
+		path:    `$.arr.*`,
+		want:    []interface{}{float64(3), float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"arr":[3,1,2]}`,
+		path:    `$.arr[*]`,
+		want:    []interface{}{float64(3), float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"x":{"name":"a"},"y":{"id":1},"z":{"name":"c"}}`,
+		path:    `$.*.name`,
+		want:    []interface{}{"a", "c"},
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `[{"a":[1,2]},{"a":[3]},{"a":4}]`,
+		path:    `$[ * ].a[*]`,
+		want:    []interface{}{float64(1), float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `{"a":1}`,
+		path:    `$.a.*`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `{"a":{"b":{"c":1}}}`,
+		path:    `$..*`,
+		want:    []interface{}{map[string]interface{}{"b": map[string]interface{}{"c": float64(1)}}, map[string]interface{}{"c": float64(1)}, float64(1)},
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     `{"a":1}`,
+		path:    `$.*a`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		src:     `{"a":1}`,
+		path:    `$[?(@.* == 1)]`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				var v interface{}
+				v, err = path.Query(json)
+				if err == nil {
+					if tt.wantErr {
+						t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+						return
+					}
+					if !reflect.DeepEqual(v, tt.want) {
+						t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					}
+					return
+				}
+			}
+
+			if !tt.wantErr {
+				t.Errorf("%v: error = %v", tt.name, err)
+			}
+		})
+	}
+}
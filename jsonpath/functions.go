@@ -0,0 +1,1762 @@
+package jsonpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type funcPred int
+
+const (
+	funcPred_None funcPred = iota
+	funcPred_Optional
+	funcPred_Required
+)
+
+// ErrFunctionNotApplicable is returned (wrapped) when the function is applied to a value of the type it does not accept.
+var ErrFunctionNotApplicable = errors.New("Function is not applicable to the value")
+
+type builtinFunction struct {
+	accepts typeSet // zero means any type
+	minArgs int
+	maxArgs int // -1 means variadic
+	pred    funcPred
+	check   func(a *ast) error
+	fn      func(c *queryContext, level int, a *ast, v interface{}) (interface{}, error)
+}
+
+// Upper bound of the length of the strings and the arrays that the functions generate (e.g. repeat, padStart).
+const maxGeneratedLength = 1 << 24
+
+// Upper bound of the number of the items that repeat generates; the items and the members of the repeated values are counted.
+// NOTE: It is smaller than maxGeneratedLength, since each item takes an interface slot (16 bytes on 64-bit platforms).
+const maxGeneratedItems = 1 << 20
+
+// Set of JSONValueType.
+type typeSet uint
+
+func typesOf(types ...JSONValueType) typeSet {
+	var ret typeSet
+	for _, t := range types {
+		ret |= 1 << uint(t)
+	}
+	return ret
+}
+
+func (s typeSet) has(t JSONValueType) bool {
+	return s == 0 || s&(1<<uint(t)) != 0
+}
+
+var builtinFunctions map[string]builtinFunction
+
+func init() {
+	builtinFunctions = map[string]builtinFunction{
+		"length":         {accepts: typesOf(Type_Array), fn: fnLength},
+		"first":          {accepts: typesOf(Type_Array), pred: funcPred_Optional, fn: fnFirst},
+		"last":           {accepts: typesOf(Type_Array), pred: funcPred_Optional, fn: fnLast},
+		"coalesceKeys":   {accepts: typesOf(Type_Object), minArgs: 1, maxArgs: -1, check: checkStringArgs, fn: fnCoalesceKeys},
+		"take":           {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkCountArgs, fn: fnTake},
+		"drop":           {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkCountArgs, fn: fnDrop},
+		"chunk":          {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkChunkArgs, fn: fnChunk},
+		"mapKeys":        {accepts: typesOf(Type_Object), minArgs: 2, maxArgs: 2, check: checkStringArgs, fn: fnMapKeys},
+		"findIndex":      {accepts: typesOf(Type_Array), pred: funcPred_Required, fn: fnFindIndex},
+		"toBool":         {accepts: typesOf(Type_Boolean, Type_Number, Type_String), fn: fnToBool},
+		"min":            {accepts: typesOf(Type_Array), fn: fnMin},
+		"max":            {accepts: typesOf(Type_Array), fn: fnMax},
+		"paths":          {accepts: typesOf(Type_Object, Type_Array), fn: fnPaths},
+		"dedupeAdjacent": {accepts: typesOf(Type_Array), fn: fnDedupeAdjacent},
+		"not":            {accepts: typesOf(Type_Boolean), fn: fnNot},
+		"typeIs":         {minArgs: 1, maxArgs: 1, check: checkTypeNameArgs, fn: fnTypeIs},
+		"head":           {fn: fnHead},
+		"toArray":        {fn: fnToArray},
+		"year":           {accepts: typesOf(Type_String), fn: fnYear},
+		"month":          {accepts: typesOf(Type_String), fn: fnMonth},
+		"day":            {accepts: typesOf(Type_String), fn: fnDay},
+		"dateFormat":     {accepts: typesOf(Type_String), minArgs: 1, maxArgs: 1, check: checkStringArgs, fn: fnDateFormat},
+		"dateAdd":        {accepts: typesOf(Type_String), minArgs: 1, maxArgs: 1, check: checkDurationArgs, fn: fnDateAdd},
+		"page":           {accepts: typesOf(Type_Array), minArgs: 2, maxArgs: 2, check: checkCountArgs, fn: fnPage},
+		"clamp":          {accepts: typesOf(Type_Number), minArgs: 2, maxArgs: 2, check: checkRangeArgs, fn: fnClamp},
+		"startsWithArr":  {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkPathArgs, fn: fnStartsWithArr},
+		"toLowerKeys":    {accepts: typesOf(Type_Object), fn: fnToLowerKeys},
+		"toUpperKeys":    {accepts: typesOf(Type_Object), fn: fnToUpperKeys},
+		"renameKeys":     {accepts: typesOf(Type_Object), minArgs: 1, maxArgs: 1, check: checkKeyMappingArgs, fn: fnRenameKeys},
+		"flattenDeep":    {accepts: typesOf(Type_Array), fn: fnFlattenDeep},
+		"round":          {accepts: typesOf(Type_Number), fn: fnRound},
+		"mapValues":      {accepts: typesOf(Type_Object, Type_Array), minArgs: 1, maxArgs: 1, check: checkFunctionNameArgs, fn: fnMapValues},
+		"depthOf":        {fn: fnDepthOf},
+		"sumOf":          {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnSumOf},
+		"avgOf":          {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnAvgOf},
+		"countMatching":  {accepts: typesOf(Type_Array), pred: funcPred_Required, fn: fnCountMatching},
+		"any":            {accepts: typesOf(Type_Array), pred: funcPred_Required, fn: fnAny},
+		"all":            {accepts: typesOf(Type_Array), pred: funcPred_Required, fn: fnAll},
+		"reverse":        {accepts: typesOf(Type_Array), fn: fnReverse},
+		"toJSONString":   {fn: fnToJSONString},
+		"fromJSONString": {accepts: typesOf(Type_String), fn: fnFromJSONString},
+		"minBy":          {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnMinBy},
+		"maxBy":          {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnMaxBy},
+		"formatNumber":   {accepts: typesOf(Type_Number), minArgs: 1, maxArgs: 1, check: checkPrecisionArgs, fn: fnFormatNumber},
+		"countBy":        {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnCountBy},
+		"distinctCount":  {accepts: typesOf(Type_Array), fn: fnDistinctCount},
+		"toInt":          {accepts: typesOf(Type_Number), fn: fnToInt},
+		"keysCount":      {accepts: typesOf(Type_Object), fn: fnKeysCount},
+		"deepLeafCount":  {fn: fnDeepLeafCount},
+		"flatMap":        {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkSubPathArgs, fn: fnFlatMap},
+		"firstNonNull":   {accepts: typesOf(Type_Array), fn: fnFirstNonNull},
+		"compact":        {accepts: typesOf(Type_Array), fn: fnCompact},
+		"in":             {accepts: typesOf(Type_Null, Type_Boolean, Type_Number, Type_String), maxArgs: -1, fn: fnIn},
+		"equals":         {minArgs: 1, maxArgs: 1, check: checkJSONArgs, fn: fnEquals},
+		"percentile":     {accepts: typesOf(Type_Array), minArgs: 1, maxArgs: 1, check: checkPercentileArgs, fn: fnPercentile},
+		"merge":          {minArgs: 2, maxArgs: -1, check: checkPathArgs, fn: fnMerge},
+		"mergeDeep":      {minArgs: 2, maxArgs: -1, check: checkPathArgs, fn: fnMergeDeep},
+		"format":         {accepts: typesOf(Type_Object), minArgs: 1, maxArgs: 1, check: checkTemplateArgs, fn: fnFormat},
+		"substr":         {accepts: typesOf(Type_String), minArgs: 1, maxArgs: 2, check: checkCountArgs, fn: fnSubstr},
+		"padStart":       {accepts: typesOf(Type_String), minArgs: 2, maxArgs: 2, check: checkPadArgs, fn: fnPadStart},
+		"padEnd":         {accepts: typesOf(Type_String), minArgs: 2, maxArgs: 2, check: checkPadArgs, fn: fnPadEnd},
+		"trimPrefix":     {accepts: typesOf(Type_String), minArgs: 1, maxArgs: 1, check: checkStringArgs, fn: fnTrimPrefix},
+		"trimSuffix":     {accepts: typesOf(Type_String), minArgs: 1, maxArgs: 1, check: checkStringArgs, fn: fnTrimSuffix},
+		"union":          {minArgs: 2, maxArgs: -1, check: checkPathArgs, fn: fnUnion},
+		"intersect":      {minArgs: 2, maxArgs: 2, check: checkPathArgs, fn: fnIntersect},
+		"difference":     {minArgs: 2, maxArgs: 2, check: checkPathArgs, fn: fnDifference},
+		"toEntries":      {accepts: typesOf(Type_Object), fn: fnToEntries},
+		"fromEntries":    {accepts: typesOf(Type_Array), fn: fnFromEntries},
+		"hash":           {fn: fnHash},
+		"repeat":         {minArgs: 1, maxArgs: 1, check: checkRepeatArgs, fn: fnRepeat},
+	}
+}
+
+// CustomFunction is the function registered by RegisterFunction.
+// It takes the current value and the literal arguments (nil, bool, float64 or string),
+// and returns the JSON value (nil, bool, float64, string, []interface{} or map[string]interface{}).
+// It should not modify the arguments.
+type CustomFunction func(v interface{}, args []interface{}) (interface{}, error)
+
+// Custom functions by the namespaced names.
+var customFunctions = struct {
+	sync.RWMutex
+	fns map[string]CustomFunction
+}{
+	fns: make(map[string]CustomFunction),
+}
+
+// RegisterFunction registers the custom function by the namespaced name (e.g. "my:transform"),
+// that is called as `$.x.(my:transform)` or with the literal arguments (e.g. `$.x.(my:transform 'a' 1)`).
+// The names without the namespace are reserved for the built-in functions.
+// It is an error if the name is malformed or already registered.
+// NOTE: The function should be registered before the paths that call it are compiled.
+func RegisterFunction(name string, fn CustomFunction) error {
+	ns, local, ok := splitFunctionName(name)
+	if !ok || !isBareName(ns) || !isBareName(local) {
+		return fmt.Errorf("RegisterFunction: Function name should be namespaced (e.g. 'ns:name'): %v", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("RegisterFunction: Function is nil: %v", name)
+	}
+
+	customFunctions.Lock()
+	defer customFunctions.Unlock()
+	if _, ok := customFunctions.fns[name]; ok {
+		return fmt.Errorf("RegisterFunction: Function is already registered: %v", name)
+	}
+	customFunctions.fns[name] = fn
+	return nil
+}
+
+func lookupCustomFunction(name string) (CustomFunction, bool) {
+	customFunctions.RLock()
+	defer customFunctions.RUnlock()
+	fn, ok := customFunctions.fns[name]
+	return fn, ok
+}
+
+// Splits the namespaced function name (e.g. "my:transform") into the namespace and the local name.
+func splitFunctionName(name string) (string, string, bool) {
+	i := strings.IndexByte(name, ':')
+	if i < 0 {
+		return "", name, false
+	}
+	return name[:i], name[i+1:], true
+}
+
+func checkFunction(a *ast) error {
+	if _, _, ok := splitFunctionName(a.name); ok {
+		if _, ok := lookupCustomFunction(a.name); !ok {
+			return errors.New("Undefined function name")
+		}
+		return nil
+	}
+
+	f, ok := builtinFunctions[a.name]
+	if !ok {
+		return errors.New("Undefined function name")
+	}
+
+	if f.pred == funcPred_Required && a.filter == nil {
+		return errors.New("Predicate is required")
+	}
+
+	n := len(a.args)
+	if n < f.minArgs || f.maxArgs >= 0 && f.maxArgs < n {
+		return fmt.Errorf("Bad number of function arguments (%v)", n)
+	}
+
+	if f.check != nil {
+		return f.check(a)
+	}
+	return nil
+}
+
+func callFunction(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	if _, _, ok := splitFunctionName(a.name); ok {
+		return callCustomFunction(c, level, a, v)
+	}
+
+	f, ok := builtinFunctions[a.name]
+	if !ok {
+		return nil, fmt.Errorf("Query: Undefined function name: Level=%v, %v", level, a.name)
+	}
+	if t := ClassifyValue(v); !f.accepts.has(t) {
+		return nil, fmt.Errorf("Query: %w: Level=%v, function=%v, type=%v", ErrFunctionNotApplicable, level, a.name, typeName(t))
+	}
+	if c.ordered {
+		v = plainValue(v)
+	}
+	return f.fn(c, level, a, v)
+}
+
+// NOTE: The custom functions see the values converted into map[string]interface{} as the built-in functions.
+// It is an error if the result is not a JSON value.
+func callCustomFunction(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	fn, ok := lookupCustomFunction(a.name)
+	if !ok {
+		return nil, fmt.Errorf("Query: Undefined function name: Level=%v, %v", level, a.name)
+	}
+	if c.ordered {
+		v = plainValue(v)
+	}
+
+	w, err := fn(v, a.args)
+	if err != nil {
+		return nil, fmt.Errorf("Query: Function %v failed: Level=%v, %w", a.name, level, err)
+	}
+	if ClassifyValue(w) == Type_Invalid {
+		return nil, fmt.Errorf("Query: Function %v returned a non-JSON value: Level=%v, %T", a.name, level, w)
+	}
+	return w, nil
+}
+
+func checkStringArgs(a *ast) error {
+	for i, arg := range a.args {
+		if _, ok := arg.(string); !ok {
+			return fmt.Errorf("Function argument %v should be a string", i)
+		}
+	}
+	return nil
+}
+
+func checkCountArgs(a *ast) error {
+	for i, arg := range a.args {
+		f, ok := arg.(float64)
+		if !ok || f < 0 || f != float64(int(f)) {
+			return fmt.Errorf("Function argument %v should be a non-negative integer", i)
+		}
+	}
+	return nil
+}
+
+// Upper bound of the number of decimal places of formatNumber (same as Number.prototype.toFixed).
+const maxFormatPrecision = 100
+
+func checkPrecisionArgs(a *ast) error {
+	if err := checkCountArgs(a); err != nil {
+		return err
+	}
+	if a.args[0].(float64) > maxFormatPrecision {
+		return fmt.Errorf("Function argument 0 should not be greater than %v", maxFormatPrecision)
+	}
+	return nil
+}
+
+func checkRepeatArgs(a *ast) error {
+	if err := checkCountArgs(a); err != nil {
+		return err
+	}
+	if a.args[0].(float64) > maxGeneratedLength {
+		return fmt.Errorf("Function argument 0 should not be greater than %v", maxGeneratedLength)
+	}
+	return nil
+}
+
+func checkChunkArgs(a *ast) error {
+	if err := checkCountArgs(a); err != nil {
+		return err
+	}
+	if a.args[0].(float64) == 0 {
+		return errors.New("Chunk size should be positive")
+	}
+	return nil
+}
+
+func checkRangeArgs(a *ast) error {
+	for i, arg := range a.args {
+		if _, ok := arg.(float64); !ok {
+			return fmt.Errorf("Function argument %v should be a number", i)
+		}
+	}
+	if a.args[1].(float64) < a.args[0].(float64) {
+		return errors.New("Upper bound should not be less than lower bound")
+	}
+	return nil
+}
+
+func checkPercentileArgs(a *ast) error {
+	for i, arg := range a.args {
+		f, ok := arg.(float64)
+		if !ok || f < 0 || 100 < f {
+			return fmt.Errorf("Function argument %v should be a number in the range [0, 100]", i)
+		}
+	}
+	return nil
+}
+
+// Pad arguments are the target length and the single-character pad string (e.g. `5 '0'`).
+func checkPadArgs(a *ast) error {
+	f, ok := a.args[0].(float64)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return errors.New("Function argument 0 should be a non-negative integer")
+	}
+	if f > maxGeneratedLength {
+		return fmt.Errorf("Function argument 0 should not be greater than %v", maxGeneratedLength)
+	}
+	s, ok := a.args[1].(string)
+	if !ok || utf8.RuneCountInString(s) != 1 {
+		return errors.New("Function argument 1 should be a single-character string")
+	}
+	return nil
+}
+
+// Duration arguments are quoted strings of the Go durations (e.g. '24h', '-1h30m').
+func checkDurationArgs(a *ast) error {
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a duration string", i)
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Errorf("Function argument %v is invalid duration: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Type name arguments are quoted strings of the JSON type names (e.g. 'number').
+func checkTypeNameArgs(a *ast) error {
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a type name", i)
+		}
+		switch s {
+		case "object", "array", "string", "number", "boolean", "null":
+		default:
+			return fmt.Errorf("Function argument %v is unknown type name: %v", i, s)
+		}
+	}
+	return nil
+}
+
+// Template arguments are quoted strings with the placeholders (e.g. '{firstName} {lastName}').
+func checkTemplateArgs(a *ast) error {
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a template string", i)
+		}
+		if _, err := expandTemplate(s, func(string) (string, error) { return "", nil }); err != nil {
+			return fmt.Errorf("Function argument %v is invalid template: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Path arguments are quoted strings of the root-relative paths (e.g. '$.prefix').
+// They are compiled into a.paths.
+func checkPathArgs(a *ast) error {
+	a.paths = make([]*CompiledJSONPath, len(a.args))
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a path", i)
+		}
+		p, err := Compile(s)
+		if err != nil {
+			return fmt.Errorf("Function argument %v should be a path: %v", i, err)
+		}
+		if p.multi {
+			return fmt.Errorf("Function argument %v should be a single-valued path", i)
+		}
+		a.paths[i] = p
+	}
+	return nil
+}
+
+// Sub-path arguments are quoted strings of the key names (e.g. 'total')
+// or the paths relative to each item (e.g. '@.price.total', '$.price.total').
+// They are compiled into a.paths.
+func checkSubPathArgs(a *ast) error {
+	a.paths = make([]*CompiledJSONPath, len(a.args))
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a key name or a relative path", i)
+		}
+		if len(s) > 0 && s[0] == '@' || s == "$" || strings.HasPrefix(s, "$.") || strings.HasPrefix(s, "$[") {
+			p, err := compileCore([]rune(s), rune(s[0]), CompileOptions{})
+			if err != nil {
+				return fmt.Errorf("Function argument %v should be a key name or a relative path: %v", i, err)
+			}
+			if p.multi {
+				return fmt.Errorf("Function argument %v should be a single-valued path", i)
+			}
+			// NOTE: The path starting with '$' is also resolved relative to each item (e.g. '$.items' is '@.items'),
+			// and it is not prefixed by Prefix. Other names starting with '$' (e.g. '$items') are the key names.
+			p.relative = true
+			a.paths[i] = p
+		} else {
+			asts := []ast{{typ: astType_NameIndexer, name: s}}
+			a.paths[i] = &CompiledJSONPath{
+				asts:     asts,
+				relative: true,
+				fast:     newFastAccessor(asts),
+			}
+		}
+	}
+	return nil
+}
+
+// JSON arguments are quoted strings of the JSON texts (e.g. '{"a":1}').
+// They are decoded into a.values.
+func checkJSONArgs(a *ast) error {
+	a.values = make([]interface{}, len(a.args))
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a JSON string", i)
+		}
+		p, err := ReadString(s)
+		if err != nil {
+			return fmt.Errorf("Function argument %v is invalid JSON: %v", i, err)
+		}
+		a.values[i] = p.value
+	}
+	return nil
+}
+
+// Key mapping arguments are JSON arguments of the objects that map the old key names to the new ones
+// (e.g. '{"old":"new"}'). They are decoded into a.values.
+func checkKeyMappingArgs(a *ast) error {
+	if err := checkJSONArgs(a); err != nil {
+		return err
+	}
+	for i, w := range a.values {
+		m, ok := w.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a JSON object", i)
+		}
+		for k, x := range m {
+			if _, ok := x.(string); !ok {
+				return fmt.Errorf("Function argument %v should map the keys to strings: %v", i, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Function name arguments are quoted strings of the functions that take no arguments (e.g. 'round').
+func checkFunctionNameArgs(a *ast) error {
+	for i, arg := range a.args {
+		s, ok := arg.(string)
+		if !ok {
+			return fmt.Errorf("Function argument %v should be a function name", i)
+		}
+		f, ok := builtinFunctions[s]
+		if !ok {
+			return fmt.Errorf("Function argument %v is undefined function name: %v", i, s)
+		}
+		if f.minArgs > 0 || f.pred == funcPred_Required {
+			return fmt.Errorf("Function argument %v should be a function without arguments: %v", i, s)
+		}
+	}
+	return nil
+}
+
+// Functions taking a predicate are followed by a filter expression (e.g. `(findIndex @.id == 5)`),
+// others are followed by the literal arguments.
+func parseFunctionParams(src []rune, start int, a *ast, opts CompileOptions) (int, error) {
+	f, ok := builtinFunctions[a.name]
+	if !ok || f.pred == funcPred_None {
+		args, end, err := parseFunctionArgs(src, start, opts)
+		if err != nil {
+			return start, err
+		}
+		a.args = args
+		return end, nil
+	}
+
+	end := skipFilterSpaces(src, start)
+	if end == len(src) || src[end] == ')' {
+		return end, nil
+	}
+
+	filter, end, err := parseFilterExpr(src, end, opts)
+	if err != nil {
+		return start, err
+	}
+	a.filter = filter
+	return end, nil
+}
+
+// Function arguments are quoted strings ('abc', "abc") and numbers (1, -2.5, 1e3)
+// separated by spaces.
+func parseFunctionArgs(src []rune, start int, opts CompileOptions) ([]interface{}, int, error) {
+	length := len(src)
+	var args []interface{}
+
+	for {
+		i, _ := skipSpaces(src, start)
+		if i == length || src[i] == ')' {
+			return args, i, nil
+		}
+		if i == start && args != nil {
+			return nil, i, newPathError(i, "compileCore: Function arguments should be separated by spaces: Pos=%v, %v", i, string(src[i:]))
+		}
+
+		ch := src[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			s, end, err := parseQuotedName(src, ch, i+1, opts)
+			if err != nil {
+				return nil, i, newPathError(i, "compileCore: Bad quoted function argument: Pos=%v, %v", i, string(src[i:]))
+			}
+			args = append(args, s)
+			start = end
+
+		case '0' <= ch && ch <= '9' || ch == '-':
+			end, err := parseFloatNumber(src, i)
+			if err != nil {
+				return nil, i, newPathError(i, "compileCore: Bad number function argument: Pos=%v, %v", i, string(src[i:]))
+			}
+			num, err := strconv.ParseFloat(string(src[i:end]), 64)
+			if err != nil {
+				return nil, i, newPathError(i, "compileCore: Number cannot be parsed: Pos=%v, %v", i, string(src[i:end]))
+			}
+			args = append(args, num)
+			start = end
+
+		default:
+			return nil, i, newPathError(i, "compileCore: Bad function argument: Pos=%v, %v", i, string(src[i:]))
+		}
+	}
+}
+
+func fnLength(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	return len(z), nil
+}
+
+// NOTE: If the predicate is given, first and last return the first / last item that matches it.
+// It is an error if no item matches.
+func fnFirst(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	if a.filter != nil {
+		for _, w := range z {
+			if a.filter.eval(c, w) {
+				return w, nil
+			}
+		}
+		return nil, fmt.Errorf("Query: No item matches the predicate: Level=%v, (first)", level)
+	}
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, (first)", level, len(z))
+	}
+	return z[0], nil
+}
+
+func fnLast(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	if a.filter != nil {
+		for i := len(z) - 1; i >= 0; i-- {
+			if a.filter.eval(c, z[i]) {
+				return z[i], nil
+			}
+		}
+		return nil, fmt.Errorf("Query: No item matches the predicate: Level=%v, (last)", level)
+	}
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, (last)", level, len(z))
+	}
+	return z[len(z)-1], nil
+}
+
+func fnReverse(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	ret := make([]interface{}, len(z))
+	for i, w := range z {
+		ret[len(z)-1-i] = w
+	}
+	return ret, nil
+}
+
+// NOTE: firstNonNull is an error if the array is empty or all items are null.
+func fnFirstNonNull(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	for _, w := range v.([]interface{}) {
+		if w != nil {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("Query: No item is not null: Level=%v, (firstNonNull)", level)
+}
+
+// NOTE: compact removes the empty items; null, "", {} and []. Other values (e.g. 0, false) are kept.
+// The items are not compacted recursively.
+func fnCompact(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	ret := make([]interface{}, 0, len(z))
+	for _, w := range z {
+		if !isEmptyValue(w) {
+			ret = append(ret, w)
+		}
+	}
+	return ret, nil
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch z := v.(type) {
+	case nil:
+		return true
+	case string:
+		return z == ""
+	case map[string]interface{}:
+		return len(z) == 0
+	case OrderedObject:
+		return len(z) == 0
+	case []interface{}:
+		return len(z) == 0
+	}
+	return false
+}
+
+// NOTE: coalesceKeys returns the value of the first key that is present and not null.
+// If no such key exists, it is an error (not null).
+func fnCoalesceKeys(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(map[string]interface{})
+	for _, arg := range a.args {
+		if w, ok := z[arg.(string)]; ok && w != nil {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("Query: None of the keys exist in the object: Level=%v, %v", level, a.args)
+}
+
+// NOTE: start and end are clamped to the array length.
+func sliceArray(z []interface{}, start, end int) []interface{} {
+	length := len(z)
+	if start > length {
+		start = length
+	}
+	if end > length {
+		end = length
+	}
+	if end < start {
+		end = start
+	}
+	return z[start:end:end]
+}
+
+func fnTake(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	return sliceArray(z, 0, int(a.args[0].(float64))), nil
+}
+
+func fnDrop(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	return sliceArray(z, int(a.args[0].(float64)), len(z)), nil
+}
+
+// NOTE: page takes the offset and the limit.
+func fnPage(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	offset := int(a.args[0].(float64))
+	limit := int(a.args[1].(float64))
+	if offset < len(z) && limit > len(z)-offset {
+		// NOTE: Avoids the overflow of offset+limit for the huge limits.
+		limit = len(z) - offset
+	}
+	return sliceArray(z, offset, offset+limit), nil
+}
+
+func fnChunk(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+
+	size := int(a.args[0].(float64))
+	if size > len(z) {
+		// NOTE: Avoids the overflow of the capacity below for the huge sizes.
+		size = len(z)
+	}
+	if size == 0 {
+		return []interface{}{}, nil
+	}
+	ret := make([]interface{}, 0, (len(z)+size-1)/size)
+	for i := 0; i < len(z); i += size {
+		ret = append(ret, sliceArray(z, i, i+size))
+	}
+	return ret, nil
+}
+
+// NOTE: mapKeys returns a copy of the object with the key renamed.
+// If the old key is absent, the object is returned unchanged.
+// If the new key already exists, its value is overwritten.
+func fnMapKeys(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(map[string]interface{})
+
+	oldKey := a.args[0].(string)
+	newKey := a.args[1].(string)
+
+	w, ok := z[oldKey]
+	if !ok {
+		return z, nil
+	}
+
+	ret := make(map[string]interface{}, len(z))
+	for k, x := range z {
+		if k != oldKey {
+			ret[k] = x
+		}
+	}
+	ret[newKey] = w
+	return ret, nil
+}
+
+func fnFindIndex(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	for i, w := range z {
+		if a.filter.eval(c, w) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func fnCountMatching(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	n := 0
+	for _, w := range v.([]interface{}) {
+		if a.filter.eval(c, w) {
+			n++
+		}
+	}
+	return float64(n), nil
+}
+
+// NOTE: any is false for the empty array.
+func fnAny(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	for _, w := range v.([]interface{}) {
+		if a.filter.eval(c, w) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NOTE: all is true for the empty array.
+func fnAll(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	for _, w := range v.([]interface{}) {
+		if !a.filter.eval(c, w) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// NOTE: in compares the scalar with the arguments in the same way as dedupeAdjacent
+// (e.g. the number 1 is not in '1'). It is false if no argument is given.
+func fnIn(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	for _, arg := range a.args {
+		if scalarEqual(v, arg) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NOTE: equals compares the value with the JSON argument in the same way as Equal.
+func fnEquals(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return Equal(v, a.values[0]), nil
+}
+
+// NOTE: toBool converts the value to a boolean:
+//   - boolean: as is
+//   - number: 0 is false, others are true
+//   - string: "true" and "1" are true, "false" and "0" are false, others are errors
+func fnToBool(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	switch z := v.(type) {
+	case bool:
+		return z, nil
+	case string:
+		switch z {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("Query: String cannot be converted to boolean: Level=%v, %v", level, z)
+	}
+
+	f, _ := toFloat64(v)
+	return f != 0, nil
+}
+
+// NOTE: min and max propagate NaN; if any item is NaN, the result is NaN.
+func fnMin(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return minMax(level, a, v, math.Min)
+}
+
+func fnMax(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return minMax(level, a, v, math.Max)
+}
+
+func minMax(level int, a *ast, v interface{}, pick func(x, y float64) float64) (interface{}, error) {
+	z := v.([]interface{})
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Function %v cannot be applied to the empty array: Level=%v", a.name, level)
+	}
+
+	var ret float64
+	for i, w := range z {
+		f, ok := toFloat64(w)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not a number: Level=%v, index=%v", level, i)
+		}
+		if i == 0 {
+			ret = f
+		} else {
+			ret = pick(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: percentile uses the nearest-rank method; the smallest item that
+// p percent of the items are less than or equal to (no interpolation).
+func fnPercentile(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Function %v cannot be applied to the empty array: Level=%v", a.name, level)
+	}
+
+	sorted := make([]float64, len(z))
+	for i, w := range z {
+		f, ok := toFloat64(w)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not a number: Level=%v, index=%v", level, i)
+		}
+		sorted[i] = f
+	}
+	sort.Float64s(sorted)
+
+	// NOTE: Dividing last keeps the exact ranks exact (e.g. 7 / 100 * 100 is 7.000000000000001).
+	rank := int(math.Ceil(a.args[0].(float64) * float64(len(sorted)) / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1], nil
+}
+
+// NOTE: paths returns the keys of the object in sorted order,
+// or the indices of the array (e.g. `[0]`) in ascending order.
+func fnPaths(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	switch z := v.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(z)
+		ret := make([]interface{}, len(keys))
+		for i, k := range keys {
+			ret[i] = k
+		}
+		return ret, nil
+	}
+
+	z := v.([]interface{})
+	ret := make([]interface{}, len(z))
+	for i := range z {
+		ret[i] = "[" + strconv.Itoa(i) + "]"
+	}
+	return ret, nil
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, bool, string, float64, int, json.Number:
+		return true
+	}
+	return false
+}
+
+// NOTE: Scalars of different types are not equal.
+func scalarEqual(x, y interface{}) bool {
+	if xf, ok := toFloat64(x); ok {
+		yf, ok := toFloat64(y)
+		return ok && xf == yf
+	}
+	return x == y
+}
+
+// NOTE: Numbers are compared by their values (e.g. 1 and 1.0 are the same).
+func fnDistinctCount(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+
+	seen := make(map[interface{}]struct{}, len(z))
+	for i, w := range z {
+		k, ok := scalarKey(w)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not a scalar: Level=%v, index=%v", level, i)
+		}
+		seen[k] = struct{}{}
+	}
+	return float64(len(seen)), nil
+}
+
+// Returns the map key of the scalar, that is equal for the equal scalars (see scalarEqual).
+func scalarKey(v interface{}) (interface{}, bool) {
+	if !isScalar(v) {
+		return nil, false
+	}
+	if f, ok := toFloat64(v); ok {
+		return f, true
+	}
+	return v, true
+}
+
+// NOTE: union returns the distinct scalar items of the arrays in the first-seen order.
+func fnUnion(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	arrs, err := arraysOfPathArgs(c, level, a)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]interface{}, 0)
+	seen := make(map[interface{}]struct{})
+	for i, z := range arrs {
+		for j, w := range z {
+			k, ok := scalarKey(w)
+			if !ok {
+				return nil, fmt.Errorf("Query: Item is not a scalar: Level=%v, %v, index=%v", level, a.args[i], j)
+			}
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			ret = append(ret, w)
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: intersect returns the distinct scalar items of the first array that are also in the second array,
+// in the order of the first array.
+func fnIntersect(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return filterByOtherArray(c, level, a, true)
+}
+
+// NOTE: difference returns the distinct scalar items of the first array that are not in the second array,
+// in the order of the first array.
+func fnDifference(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return filterByOtherArray(c, level, a, false)
+}
+
+// Returns the distinct items of the first array whose membership in the second array is the same as `in`.
+func filterByOtherArray(c *queryContext, level int, a *ast, in bool) (interface{}, error) {
+	arrs, err := arraysOfPathArgs(c, level, a)
+	if err != nil {
+		return nil, err
+	}
+	other, err := scalarKeySet(level, a.args[1], arrs[1])
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]interface{}, 0)
+	seen := make(map[interface{}]struct{})
+	for j, w := range arrs[0] {
+		k, ok := scalarKey(w)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not a scalar: Level=%v, %v, index=%v", level, a.args[0], j)
+		}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if _, ok := other[k]; ok == in {
+			ret = append(ret, w)
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: toEntries returns the array of {"key": k, "value": v} sorted by the keys.
+func fnToEntries(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(map[string]interface{})
+
+	ret := make([]interface{}, 0, len(z))
+	for _, k := range sortedKeys(z) {
+		ret = append(ret, map[string]interface{}{
+			"key":   k,
+			"value": z[k],
+		})
+	}
+	return ret, nil
+}
+
+// NOTE: fromEntries is the inverse of toEntries. If a key appears more than once, the last value wins.
+func fnFromEntries(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+
+	ret := make(map[string]interface{}, len(z))
+	for i, w := range z {
+		m, ok := w.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not an object: Level=%v, index=%v", level, i)
+		}
+		k, ok := m["key"].(string)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item key is not a string: Level=%v, index=%v", level, i)
+		}
+		x, ok := m["value"]
+		if !ok {
+			return nil, fmt.Errorf("Query: Item does not have the value: Level=%v, index=%v", level, i)
+		}
+		ret[k] = x
+	}
+	return ret, nil
+}
+
+func scalarKeySet(level int, arg interface{}, z []interface{}) (map[interface{}]struct{}, error) {
+	set := make(map[interface{}]struct{}, len(z))
+	for j, w := range z {
+		k, ok := scalarKey(w)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item is not a scalar: Level=%v, %v, index=%v", level, arg, j)
+		}
+		set[k] = struct{}{}
+	}
+	return set, nil
+}
+
+// NOTE: dedupeAdjacent removes only the consecutive duplicates (like `uniq` command).
+func fnDedupeAdjacent(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+
+	ret := make([]interface{}, 0, len(z))
+	for i, w := range z {
+		if !isScalar(w) {
+			return nil, fmt.Errorf("Query: Item is not a scalar: Level=%v, index=%v", level, i)
+		}
+		if i > 0 && scalarEqual(z[i-1], w) {
+			continue
+		}
+		ret = append(ret, w)
+	}
+	return ret, nil
+}
+
+func fnNot(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return !v.(bool), nil
+}
+
+// NOTE: head returns the first item if the value is an array, otherwise the value itself.
+func fnHead(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z, ok := v.([]interface{})
+	if !ok {
+		return v, nil
+	}
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, (head)", level, len(z))
+	}
+	return z[0], nil
+}
+
+// NOTE: toArray returns the array as is, an empty array for null, otherwise the value wrapped in an array.
+func fnToArray(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	switch z := v.(type) {
+	case []interface{}:
+		return z, nil
+	case nil:
+		return []interface{}{}, nil
+	}
+	return []interface{}{v}, nil
+}
+
+// NOTE: year, month and day parse the RFC3339 timestamp string and return the part in its own time zone offset.
+func fnYear(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	t, err := parseTimestamp(level, v.(string))
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Year()), nil
+}
+
+func fnMonth(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	t, err := parseTimestamp(level, v.(string))
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Month()), nil
+}
+
+func fnDay(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	t, err := parseTimestamp(level, v.(string))
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Day()), nil
+}
+
+// NOTE: dateFormat renders the RFC3339 timestamp string in the Go layout (e.g. '2006-01-02')
+// in its own time zone offset.
+func fnDateFormat(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	t, err := parseTimestamp(level, v.(string))
+	if err != nil {
+		return nil, err
+	}
+	return t.Format(a.args[0].(string)), nil
+}
+
+// NOTE: dateAdd adds the Go duration (e.g. '24h', '-1h30m') to the RFC3339 timestamp string
+// and returns the RFC3339 timestamp string in the same time zone offset.
+func fnDateAdd(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	t, err := parseTimestamp(level, v.(string))
+	if err != nil {
+		return nil, err
+	}
+	d, _ := time.ParseDuration(a.args[0].(string))
+	return t.Add(d).Format(time.RFC3339Nano), nil
+}
+
+func parseTimestamp(level int, s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Query: String cannot be parsed as RFC3339 timestamp: Level=%v, %v", level, s)
+	}
+	return t, nil
+}
+
+// NOTE: clamp propagates NaN.
+func fnClamp(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	f, _ := toFloat64(v)
+	return math.Max(a.args[0].(float64), math.Min(a.args[1].(float64), f)), nil
+}
+
+// NOTE: startsWithArr reports whether the array begins with the items of the array that the path argument points to.
+// Items are compared as `==` in the filter.
+func fnStartsWithArr(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.([]interface{})
+
+	w, err := queryPathArg(c, a.paths[0])
+	if err != nil {
+		return nil, err
+	}
+	prefix, ok := w.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Query: Function argument is not an array: Level=%v, %v", level, a.args[0])
+	}
+
+	if len(z) < len(prefix) {
+		return false, nil
+	}
+	for i := range prefix {
+		if !compareValues("==", z[i], prefix[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func fnToLowerKeys(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return mapObjectKeys(v.(map[string]interface{}), strings.ToLower), nil
+}
+
+func fnToUpperKeys(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return mapObjectKeys(v.(map[string]interface{}), strings.ToUpper), nil
+}
+
+// NOTE: renameKeys renames the keys by the mapping. The keys not in the mapping are kept.
+// The collisions are resolved in the same way as toLowerKeys.
+func fnRenameKeys(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	mapping := a.values[0].(map[string]interface{})
+	return mapObjectKeys(v.(map[string]interface{}), func(k string) string {
+		if w, ok := mapping[k]; ok {
+			return w.(string)
+		}
+		return k
+	}), nil
+}
+
+// NOTE: Returns a copy of the object with the keys converted.
+// If the converted keys collide, the value of the last key in the sorted order of the original keys wins
+// (e.g. `{"A":1,"a":2}` to `{"a":2}`).
+func mapObjectKeys(z map[string]interface{}, conv func(string) string) map[string]interface{} {
+	ret := make(map[string]interface{}, len(z))
+	for _, k := range sortedKeys(z) {
+		ret[conv(k)] = z[k]
+	}
+	return ret
+}
+
+// NOTE: flattenDeep flattens the nested arrays recursively (with an explicit stack).
+// Empty arrays are removed.
+func fnFlattenDeep(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	type frame struct {
+		items []interface{}
+		index int
+	}
+
+	ret := make([]interface{}, 0)
+	stack := []frame{{items: v.([]interface{})}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.index == len(top.items) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		w := top.items[top.index]
+		top.index++
+
+		if z, ok := w.([]interface{}); ok {
+			stack = append(stack, frame{items: z})
+		} else {
+			ret = append(ret, w)
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: round rounds half away from zero.
+func fnRound(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	f, _ := toFloat64(v)
+	return math.Round(f), nil
+}
+
+// NOTE: toInt truncates the number toward zero. The result is still float64 (e.g. -1.7 to -1).
+func fnToInt(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	f, _ := toFloat64(v)
+	t := math.Trunc(f)
+	if t == 0 {
+		// NOTE: Avoids -0.
+		t = 0
+	}
+	return t, nil
+}
+
+// NOTE: mapValues applies the function to each value of the object (or item of the array),
+// and returns a new object (or array). If the function fails on any value, it is an error.
+func fnMapValues(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	f := &ast{
+		typ:  astType_Function,
+		name: a.args[0].(string),
+	}
+
+	switch z := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(z))
+		for k, w := range z {
+			x, err := callFunction(c, level, f, w)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = x
+		}
+		return ret, nil
+	}
+
+	z := v.([]interface{})
+	ret := make([]interface{}, len(z))
+	for i, w := range z {
+		x, err := callFunction(c, level, f, w)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = x
+	}
+	return ret, nil
+}
+
+// NOTE: depthOf returns the maximum nesting depth; scalars are 0, objects and arrays (even if empty) are 1 + the depth of the children.
+func fnDepthOf(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	type frame struct {
+		value interface{}
+		depth int
+	}
+
+	deepest := 0
+	stack := []frame{{value: v}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch z := top.value.(type) {
+		case map[string]interface{}:
+			for _, w := range z {
+				stack = append(stack, frame{value: w, depth: top.depth + 1})
+			}
+		case []interface{}:
+			for _, w := range z {
+				stack = append(stack, frame{value: w, depth: top.depth + 1})
+			}
+		default:
+			if top.depth > deepest {
+				deepest = top.depth
+			}
+			continue
+		}
+		if top.depth+1 > deepest {
+			deepest = top.depth + 1
+		}
+	}
+	return float64(deepest), nil
+}
+
+func fnKeysCount(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return float64(len(v.(map[string]interface{}))), nil
+}
+
+// NOTE: deepLeafCount counts the scalars (including null) in the sub-tree; a scalar itself is 1,
+// and empty objects and arrays are 0.
+func fnDeepLeafCount(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	n := 0
+	stack := []interface{}{v}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch z := top.(type) {
+		case map[string]interface{}:
+			for _, w := range z {
+				stack = append(stack, w)
+			}
+		case []interface{}:
+			stack = append(stack, z...)
+		default:
+			n++
+		}
+	}
+	return float64(n), nil
+}
+
+// NOTE: flatMap concatenates the arrays of the sub-path of each item.
+// The items that the sub-path does not match are skipped. It is an error if the value is not an array.
+func fnFlatMap(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	ret := make([]interface{}, 0)
+	for i, w := range v.([]interface{}) {
+		x, err := a.paths[0].query(c, w)
+		if err != nil {
+			continue
+		}
+		z, ok := x.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Query: Item value is not an array: Level=%v, index=%v", level, i)
+		}
+		ret = append(ret, z...)
+	}
+	return ret, nil
+}
+
+// NOTE: sumOf and avgOf skip the items that the sub-path does not match (e.g. missing key).
+// It is an error if the matched value is not a number.
+func fnSumOf(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	sum, _, err := sumOfSubPath(c, level, a, v)
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// NOTE: avgOf is an error if no item matches.
+func fnAvgOf(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	sum, n, err := sumOfSubPath(c, level, a, v)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("Query: No item has the value: Level=%v, %v", level, a.args[0])
+	}
+	return sum / float64(n), nil
+}
+
+// NOTE: minBy and maxBy return the first item if there are ties.
+// Every item should have the number value of the sub-path.
+func fnMinBy(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return extremeBySubPath(c, level, a, v, func(x, y float64) bool { return x < y })
+}
+
+func fnMaxBy(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return extremeBySubPath(c, level, a, v, func(x, y float64) bool { return x > y })
+}
+
+func extremeBySubPath(c *queryContext, level int, a *ast, v interface{}, better func(x, y float64) bool) (interface{}, error) {
+	z := v.([]interface{})
+	if len(z) == 0 {
+		return nil, fmt.Errorf("Query: Function %v cannot be applied to the empty array: Level=%v", a.name, level)
+	}
+
+	var ret interface{}
+	var best float64
+	for i, w := range z {
+		x, err := a.paths[0].query(c, w)
+		if err != nil {
+			return nil, fmt.Errorf("Query: Item does not have the value: Level=%v, index=%v, %v", level, i, err)
+		}
+		f, ok := toFloat64(x)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item value is not a number: Level=%v, index=%v", level, i)
+		}
+		if i == 0 || better(f, best) {
+			ret = w
+			best = f
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: countBy groups the items by the value of the sub-path stringified as the format function does
+// (e.g. 1 and "1" are the same group). The items that the sub-path does not match are skipped.
+func fnCountBy(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	ret := make(map[string]interface{})
+	for i, w := range v.([]interface{}) {
+		x, err := a.paths[0].query(c, w)
+		if err != nil {
+			continue
+		}
+		key, ok := scalarToString(x)
+		if !ok {
+			return nil, fmt.Errorf("Query: Item value is not a scalar: Level=%v, index=%v", level, i)
+		}
+		n, _ := ret[key].(float64)
+		ret[key] = n + 1
+	}
+	return ret, nil
+}
+
+func sumOfSubPath(c *queryContext, level int, a *ast, v interface{}) (float64, int, error) {
+	sum := float64(0)
+	n := 0
+	for i, w := range v.([]interface{}) {
+		x, err := a.paths[0].query(c, w)
+		if err != nil {
+			continue
+		}
+		f, ok := toFloat64(x)
+		if !ok {
+			return 0, 0, fmt.Errorf("Query: Item value is not a number: Level=%v, index=%v", level, i)
+		}
+		sum += f
+		n++
+	}
+	return sum, n, nil
+}
+
+// NOTE: substr takes the start and the optional length in runes.
+// The out of range bounds are clamped.
+func fnSubstr(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	runes := []rune(v.(string))
+	length := len(runes)
+
+	start := int(a.args[0].(float64))
+	if start > length {
+		start = length
+	}
+	end := length
+	if len(a.args) > 1 {
+		if n := int(a.args[1].(float64)); n < end-start {
+			end = start + n
+		}
+	}
+	return string(runes[start:end]), nil
+}
+
+// NOTE: padStart and padEnd pad the string to the length in runes.
+// The string is returned as is if it is not shorter than the length.
+func fnPadStart(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(string)
+	return padding(z, a) + z, nil
+}
+
+func fnPadEnd(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(string)
+	return z + padding(z, a), nil
+}
+
+func padding(s string, a *ast) string {
+	n := int(a.args[0].(float64)) - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat(a.args[1].(string), n)
+}
+
+func fnTrimPrefix(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return strings.TrimPrefix(v.(string), a.args[0].(string)), nil
+}
+
+func fnTrimSuffix(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return strings.TrimSuffix(v.(string), a.args[0].(string)), nil
+}
+
+// NOTE: repeat concatenates the string the number of times,
+// and makes the array of the number of the value for any other type (including the arrays).
+// The size of the array is bounded by the number of the items times the length of the repeated array or object.
+func fnRepeat(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	n := int(a.args[0].(float64))
+	if z, ok := v.(string); ok {
+		if n > 0 && len(z) > maxGeneratedLength/n {
+			return nil, fmt.Errorf("Query: Result is too long: Level=%v, length=%v, count=%v", level, len(z), n)
+		}
+		return strings.Repeat(z, n), nil
+	}
+
+	size := 1
+	switch z := v.(type) {
+	case []interface{}:
+		size = len(z)
+	case map[string]interface{}:
+		size = len(z)
+	}
+	if size < 1 {
+		size = 1
+	}
+	if n > 0 && size > maxGeneratedItems/n {
+		return nil, fmt.Errorf("Query: Result is too large: Level=%v, size=%v, count=%v", level, size, n)
+	}
+	ret := make([]interface{}, n)
+	for i := range ret {
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+func fnTypeIs(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	return typeName(ClassifyValue(v)) == a.args[0].(string), nil
+}
+
+// NOTE: formatNumber formats the number with the fixed number of decimal places (e.g. 1.50).
+func fnFormatNumber(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	f, _ := toFloat64(v)
+	return strconv.FormatFloat(f, 'f', int(a.args[0].(float64)), 64), nil
+}
+
+// NOTE: format replaces the placeholders `{key}` with the values of the object.
+// Missing keys are replaced with empty strings. `{{` and `}}` are the literal braces.
+func fnFormat(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	z := v.(map[string]interface{})
+	return expandTemplate(a.args[0].(string), func(key string) (string, error) {
+		w, ok := z[key]
+		if !ok {
+			return "", nil
+		}
+		s, ok := scalarToString(w)
+		if !ok {
+			return "", fmt.Errorf("Query: Placeholder value is not a scalar: Level=%v, %v", level, key)
+		}
+		return s, nil
+	})
+}
+
+func expandTemplate(tmpl string, lookup func(key string) (string, error)) (string, error) {
+	var sb strings.Builder
+	length := len(tmpl)
+
+	for i := 0; i < length; i++ {
+		ch := tmpl[i]
+		switch ch {
+		case '{':
+			if i+1 < length && tmpl[i+1] == '{' {
+				sb.WriteByte('{')
+				i++
+				continue
+			}
+			end := strings.IndexByte(tmpl[i+1:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("Unterminated placeholder: Pos=%v", i)
+			}
+			s, err := lookup(tmpl[i+1 : i+1+end])
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(s)
+			i += end + 1
+		case '}':
+			if i+1 < length && tmpl[i+1] == '}' {
+				sb.WriteByte('}')
+				i++
+				continue
+			}
+			return "", fmt.Errorf("Unmatched '}': Pos=%v", i)
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+// Numbers are formatted in the shortest decimal notation (e.g. 1.5, 100), null is "null".
+func scalarToString(v interface{}) (string, bool) {
+	switch z := v.(type) {
+	case nil:
+		return "null", true
+	case string:
+		return z, true
+	case bool:
+		return strconv.FormatBool(z), true
+	}
+	if f, ok := toFloat64(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// NOTE: toJSONString returns the compact JSON of the value.
+func fnToJSONString(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("Query: Value cannot be marshaled: Level=%v, %v", level, err)
+	}
+	return string(b), nil
+}
+
+// NOTE: hash returns the hex SHA-256 of the stable JSON (see MarshalStable),
+// so that the equal values hash identically regardless of the key order.
+// The numbers (including json.Number) are normalized into float64 before that (e.g. 1 and 1.0 hash identically).
+func fnHash(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	w, err := normalizeValue(v, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Query: Value cannot be marshaled: Level=%v, %v", level, err)
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, fmt.Errorf("Query: Value cannot be marshaled: Level=%v, %v", level, err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NOTE: fromJSONString decodes the string in the same way as ReadString.
+func fnFromJSONString(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	p, err := ReadString(v.(string))
+	if err != nil {
+		return nil, fmt.Errorf("Query: String cannot be decoded as JSON: Level=%v, %v", level, err)
+	}
+	return p.value, nil
+}
+
+// NOTE: merge ignores the current value and shallowly merges the objects of the path arguments.
+// The later ones win.
+func fnMerge(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	objs, err := objectsOfPathArgs(c, level, a)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]interface{})
+	for _, m := range objs {
+		for k, w := range m {
+			ret[k] = w
+		}
+	}
+	return ret, nil
+}
+
+// NOTE: mergeDeep is like merge, but merges the nested objects recursively.
+// Arrays and scalars (including null) replace the values wholesale. The source objects are not modified.
+func fnMergeDeep(c *queryContext, level int, a *ast, v interface{}) (interface{}, error) {
+	objs, err := objectsOfPathArgs(c, level, a)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]interface{})
+	for _, m := range objs {
+		ret = mergeObjectsDeep(ret, m)
+	}
+	return ret, nil
+}
+
+func mergeObjectsDeep(base, patch map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(base)+len(patch))
+	for k, w := range base {
+		ret[k] = w
+	}
+	for k, w := range patch {
+		x, ok1 := ret[k].(map[string]interface{})
+		y, ok2 := w.(map[string]interface{})
+		if ok1 && ok2 {
+			ret[k] = mergeObjectsDeep(x, y)
+		} else {
+			ret[k] = w
+		}
+	}
+	return ret
+}
+
+func objectsOfPathArgs(c *queryContext, level int, a *ast) ([]map[string]interface{}, error) {
+	objs := make([]map[string]interface{}, len(a.paths))
+	for i, p := range a.paths {
+		w, err := queryPathArg(c, p)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := w.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Query: Function argument is not an object: Level=%v, %v", level, a.args[i])
+		}
+		objs[i] = m
+	}
+	return objs, nil
+}
+
+// Queries the root-relative path argument.
+// NOTE: The values of the ordered documents are converted into map[string]interface{} as the current value.
+func queryPathArg(c *queryContext, p *CompiledJSONPath) (interface{}, error) {
+	w, err := p.query(c, c.root)
+	if err != nil {
+		return nil, err
+	}
+	if c.ordered {
+		w = plainValue(w)
+	}
+	return w, nil
+}
+
+func arraysOfPathArgs(c *queryContext, level int, a *ast) ([][]interface{}, error) {
+	arrs := make([][]interface{}, len(a.paths))
+	for i, p := range a.paths {
+		w, err := queryPathArg(c, p)
+		if err != nil {
+			return nil, err
+		}
+		z, ok := w.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Query: Function argument is not an array: Level=%v, %v", level, a.args[i])
+		}
+		arrs[i] = z
+	}
+	return arrs, nil
+}
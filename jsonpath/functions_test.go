@@ -0,0 +1,2989 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "coalesceKeys 1",
+		src:     `{"emailAddress":"a@example.com","email":"b@example.com"}`,
+		path:    `$.(coalesceKeys 'emailAddress' 'email')`,
+		want:    "a@example.com",
+		wantErr: false,
+	}, {
+		name:    "coalesceKeys 2",
+		src:     `{"email":"b@example.com"}`,
+		path:    `$.(coalesceKeys 'emailAddress' 'email')`,
+		want:    "b@example.com",
+		wantErr: false,
+	}, {
+		name:    "coalesceKeys 3",
+		src:     `{"emailAddress":null,"email":"b@example.com"}`,
+		path:    `$.( coalesceKeys "emailAddress"  "email" )`,
+		want:    "b@example.com",
+		wantErr: false,
+	}, {
+		name:    "coalesceKeys 4",
+		src:     `{"name":"foo"}`,
+		path:    `$.(coalesceKeys 'emailAddress' 'email')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "coalesceKeys 5",
+		src:     `[{"email":"b@example.com"}]`,
+		path:    `$.(coalesceKeys 'email')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "coalesceKeys 6",
+		src:     `{"email":"b@example.com"}`,
+		path:    `$.(coalesceKeys)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "coalesceKeys 7",
+		src:     `{"email":"b@example.com"}`,
+		path:    `$.(coalesceKeys 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "length 1",
+		src:     `[1,2]`,
+		path:    `$.(length 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "undefined 1",
+		src:     `[1,2]`,
+		path:    `$.(foo)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "take 1",
+		src:     `[1,2,3]`,
+		path:    `$.(take 2)`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "take 2",
+		src:     `[1,2,3]`,
+		path:    `$.(take 3)`,
+		want:    []interface{}{float64(1), float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "take 3",
+		src:     `[1,2,3]`,
+		path:    `$.(take 10)`,
+		want:    []interface{}{float64(1), float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "take 4",
+		src:     `[1,2,3]`,
+		path:    `$.(take 0)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "take 5",
+		src:     `[1,2,3]`,
+		path:    `$.(take -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "take 6",
+		src:     `[1,2,3]`,
+		path:    `$.(take 1.5)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "take 7",
+		src:     `{"a":1}`,
+		path:    `$.(take 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "drop 1",
+		src:     `[1,2,3]`,
+		path:    `$.(drop 2)`,
+		want:    []interface{}{float64(3)},
+		wantErr: false,
+	}, {
+		name:    "drop 2",
+		src:     `[1,2,3]`,
+		path:    `$.(drop 3)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "drop 3",
+		src:     `[1,2,3]`,
+		path:    `$.(drop 10)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "drop 4",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a.(drop 1)[0]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "chunk 1",
+		src:     `[1,2,3,4,5,6]`,
+		path:    `$.(chunk 3)`,
+		want:    []interface{}{[]interface{}{float64(1), float64(2), float64(3)}, []interface{}{float64(4), float64(5), float64(6)}},
+		wantErr: false,
+	}, {
+		name:    "chunk 2",
+		src:     `[1,2,3,4,5]`,
+		path:    `$.(chunk 2)`,
+		want:    []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{float64(3), float64(4)}, []interface{}{float64(5)}},
+		wantErr: false,
+	}, {
+		name:    "chunk 3",
+		src:     `[]`,
+		path:    `$.(chunk 2)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "chunk 4",
+		src:     `[1,2,3]`,
+		path:    `$.(chunk 0)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "chunk 5",
+		src:     `[1,2,3]`,
+		path:    `$.(chunk -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "chunk 6",
+		src:     `"abc"`,
+		path:    `$.(chunk 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mapKeys 1",
+		src:     `{"old":1,"other":2}`,
+		path:    `$.(mapKeys 'old' 'new')`,
+		want:    map[string]interface{}{"new": float64(1), "other": float64(2)},
+		wantErr: false,
+	}, {
+		name:    "mapKeys 2",
+		src:     `{"other":2}`,
+		path:    `$.(mapKeys 'old' 'new')`,
+		want:    map[string]interface{}{"other": float64(2)},
+		wantErr: false,
+	}, {
+		name:    "mapKeys 3",
+		src:     `{"old":1,"new":2}`,
+		path:    `$.(mapKeys 'old' 'new')`,
+		want:    map[string]interface{}{"new": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "mapKeys 4",
+		src:     `{"old":1}`,
+		path:    `$.(mapKeys 'old' 'old')`,
+		want:    map[string]interface{}{"old": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "mapKeys 5",
+		src:     `[1]`,
+		path:    `$.(mapKeys 'old' 'new')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mapKeys 6",
+		src:     `{"old":1}`,
+		path:    `$.(mapKeys 'old')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "findIndex 1",
+		src:     `[{"id":5},{"id":6},{"id":5}]`,
+		path:    `$.(findIndex @.id == 5)`,
+		want:    int(0),
+		wantErr: false,
+	}, {
+		name:    "findIndex 2",
+		src:     `{"items":[{"id":1},{"id":5},{"id":5}]}`,
+		path:    `$.items.(findIndex @.id == 5)`,
+		want:    int(1),
+		wantErr: false,
+	}, {
+		name:    "findIndex 3",
+		src:     `{"items":[{"id":1},{"id":2}]}`,
+		path:    `$.items.( findIndex @.id == 5 && @.id > 0 )`,
+		want:    int(-1),
+		wantErr: false,
+	}, {
+		name:    "findIndex 4",
+		src:     `{"items":[1,2,3]}`,
+		path:    `$.items.(findIndex @ == 3)`,
+		want:    int(2),
+		wantErr: false,
+	}, {
+		name:    "findIndex 5",
+		src:     `{"items":[1,2,3]}`,
+		path:    `$.items.(findIndex)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "findIndex 6",
+		src:     `{"items":{"a":1}}`,
+		path:    `$.items.(findIndex @ == 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "toBool 1",
+		src:     `["true","false","1","0"]`,
+		path:    `$[0].(toBool)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "toBool 2",
+		src:     `["true","false","1","0"]`,
+		path:    `$[1].(toBool)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "toBool 3",
+		src:     `["true","false","1","0"]`,
+		path:    `$[2].(toBool)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "toBool 4",
+		src:     `["true","false","1","0"]`,
+		path:    `$[3].(toBool)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "toBool 5",
+		src:     `[0, 2.5, -1]`,
+		path:    `$[0].(toBool)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "toBool 6",
+		src:     `[0, 2.5, -1]`,
+		path:    `$[1].(toBool)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "toBool 7",
+		src:     `[0, 2.5, -1]`,
+		path:    `$[2].(toBool)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "toBool 8",
+		src:     `[true, false]`,
+		path:    `$[0].(toBool)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "toBool 9",
+		src:     `[true, false]`,
+		path:    `$[1].(toBool)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "toBool 10",
+		src:     `["yes"]`,
+		path:    `$[0].(toBool)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "toBool 11",
+		src:     `["TRUE"]`,
+		path:    `$[0].(toBool)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "toBool 12",
+		src:     `[null]`,
+		path:    `$[0].(toBool)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "min 1",
+		src:     `[3, -1.5, 2]`,
+		path:    `$.(min)`,
+		want:    float64(-1.5),
+		wantErr: false,
+	}, {
+		name:    "max 1",
+		src:     `[3, -1.5, 2]`,
+		path:    `$.(max)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "min 2",
+		src:     `[]`,
+		path:    `$.(min)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "max 2",
+		src:     `[1, "2"]`,
+		path:    `$.(max)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "max 3",
+		src:     `{"a":1}`,
+		path:    `$.(max)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "paths 1",
+		src:     `{"b":1,"a":{"x":2},"c":[3]}`,
+		path:    `$.(paths)`,
+		want:    []interface{}{"a", "b", "c"},
+		wantErr: false,
+	}, {
+		name:    "paths 2",
+		src:     `[1,2,3,4,5,6,7,8,9,10,11]`,
+		path:    `$.(paths)`,
+		want:    []interface{}{"[0]", "[1]", "[2]", "[3]", "[4]", "[5]", "[6]", "[7]", "[8]", "[9]", "[10]"},
+		wantErr: false,
+	}, {
+		name:    "paths 3",
+		src:     `{}`,
+		path:    `$.(paths)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "paths 4",
+		src:     `"abc"`,
+		path:    `$.(paths)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dedupeAdjacent 1",
+		src:     `[1,1,2,2,2,3,"a","a",null,null,true,true,1]`,
+		path:    `$.(dedupeAdjacent)`,
+		want:    []interface{}{float64(1), float64(2), float64(3), "a", nil, true, float64(1)},
+		wantErr: false,
+	}, {
+		name:    "dedupeAdjacent 2",
+		src:     `[1,2,3,"1"]`,
+		path:    `$.(dedupeAdjacent)`,
+		want:    []interface{}{float64(1), float64(2), float64(3), "1"},
+		wantErr: false,
+	}, {
+		name:    "dedupeAdjacent 3",
+		src:     `[]`,
+		path:    `$.(dedupeAdjacent)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "dedupeAdjacent 4",
+		src:     `[1,[1]]`,
+		path:    `$.(dedupeAdjacent)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "not 1",
+		src:     `{"a":true,"b":false,"c":"true","d":0}`,
+		path:    `$.a.(not)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "not 2",
+		src:     `{"a":true,"b":false,"c":"true","d":0}`,
+		path:    `$.b.(not)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "not 3",
+		src:     `{"a":true,"b":false,"c":"true","d":0}`,
+		path:    `$.c.(not)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "not 4",
+		src:     `{"a":true,"b":false,"c":"true","d":0}`,
+		path:    `$.d.(toBool).(not)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "not 5",
+		src:     `{"a":true,"b":false,"c":"true","d":0}`,
+		path:    `$.(not)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "head 1",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.a.(head)`,
+		want:    "x",
+		wantErr: false,
+	}, {
+		name:    "head 2",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.b.(head)`,
+		want:    "y",
+		wantErr: false,
+	}, {
+		name:    "head 3",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.c.(head)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "head 4",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.d.(head)`,
+		want:    []interface{}{float64(1)},
+		wantErr: false,
+	}, {
+		name:    "head 5",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.e.(head)`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "head 6",
+		src:     `{"a":"x","b":["y"],"c":[],"d":[[1],2],"e":null,"f":{"g":1}}`,
+		path:    `$.f.(head).g`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "toArray 1",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.a.(toArray)`,
+		want:    []interface{}{"x"},
+		wantErr: false,
+	}, {
+		name:    "toArray 2",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.b.(toArray)`,
+		want:    []interface{}{float64(1), float64(2)},
+		wantErr: false,
+	}, {
+		name:    "toArray 3",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.c.(toArray)`,
+		want:    []interface{}{map[string]interface{}{"d": float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "toArray 4",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.e.(toArray)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "toArray 5",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.f.(toArray)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "toArray 6",
+		src:     `{"a":"x","b":[1,2],"c":{"d":1},"e":null,"f":[]}`,
+		path:    `$.a.(toArray).(length)`,
+		want:    1,
+		wantErr: false,
+	}, {
+		name:    "year 1",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.a.(year)`,
+		want:    float64(2024),
+		wantErr: false,
+	}, {
+		name:    "month 1",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.a.(month)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "day 1",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.a.(day)`,
+		want:    float64(15),
+		wantErr: false,
+	}, {
+		name:    "year 2",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.b.(year)`,
+		want:    float64(2024),
+		wantErr: false,
+	}, {
+		name:    "month 2",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.b.(month)`,
+		want:    float64(12),
+		wantErr: false,
+	}, {
+		name:    "day 2",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.b.(day)`,
+		want:    float64(31),
+		wantErr: false,
+	}, {
+		name:    "year 3",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.c.(year)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "month 3",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.d.(month)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "day 3",
+		src:     `{"a":"2024-03-15T23:30:00+09:00","b":"2024-12-31T23:59:59.999Z","c":"2024/03/15","d":"2024-03-15"}`,
+		path:    `$.(day)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "findIndex comment",
+		src:     `{"items":[{"id":1},{"id":5}]}`,
+		path:    `$.items.( findIndex /* by id */ @.id  ==  5 /* c */ )`,
+		want:    1,
+		wantErr: false,
+	}, {
+		name:    "page 1",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 2 3)`,
+		want:    []interface{}{float64(2), float64(3), float64(4)},
+		wantErr: false,
+	}, {
+		name:    "page 2",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 6 3)`,
+		want:    []interface{}{float64(6)},
+		wantErr: false,
+	}, {
+		name:    "page 3",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 20 40)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "page 4",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 0 0)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "page 5",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page -1 3)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "page 6",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 1 -3)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "page 7",
+		src:     `[0,1,2,3,4,5,6]`,
+		path:    `$.(page 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "clamp 1",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[0].(clamp 0 100)`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "clamp 2",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[1].(clamp 0 100)`,
+		want:    float64(50),
+		wantErr: false,
+	}, {
+		name:    "clamp 3",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[2].(clamp 0 100)`,
+		want:    float64(100),
+		wantErr: false,
+	}, {
+		name:    "clamp 4",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[4].(clamp -1.5 -1.5)`,
+		want:    float64(-1.5),
+		wantErr: false,
+	}, {
+		name:    "clamp 5",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$.(length).(clamp 0 3)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "clamp 6",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[1].(clamp 100 0)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "clamp 7",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[1].(clamp '0' 100)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "clamp 8",
+		src:     `[-5,50,150,0,100]`,
+		path:    `$[1].(clamp 0)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "clamp 9",
+		src:     `["a"]`,
+		path:    `$[0].(clamp 0 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "startsWithArr 1",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.prefix')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "startsWithArr 2",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.other')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "startsWithArr 3",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.long')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "startsWithArr 4",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.empty')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "startsWithArr 5",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.s')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "startsWithArr 6",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$.missing')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "startsWithArr 7",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr 'prefix')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "startsWithArr 8",
+		src:     `{"route":["api","v1","users"],"prefix":["api","v1"],"other":["api","v2"],"long":["api","v1","users","1"],"empty":[],"s":"x"}`,
+		path:    `$.route.(startsWithArr '$..prefix')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "startsWithArr 9",
+		src:     `{"items":[[1,2,3],[1,3]],"prefix":[1,2]}`,
+		path:    `$.items[?(@.(startsWithArr '$.prefix') == true)]`,
+		want:    []interface{}{[]interface{}{float64(1), float64(2), float64(3)}},
+		wantErr: false,
+	}, {
+		name:    "toLowerKeys 1",
+		src:     `{"Content-Type":"a","X-Id":{"Nested":1}}`,
+		path:    `$.(toLowerKeys)`,
+		want:    map[string]interface{}{"content-type": "a", "x-id": map[string]interface{}{"Nested": float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "toLowerKeys 2",
+		src:     `{"A":1,"a":2,"B":3}`,
+		path:    `$.(toLowerKeys)`,
+		want:    map[string]interface{}{"a": float64(2), "b": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "toUpperKeys 1",
+		src:     `{"Content-Type":"a","x-id":1}`,
+		path:    `$.(toUpperKeys)`,
+		want:    map[string]interface{}{"CONTENT-TYPE": "a", "X-ID": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "toUpperKeys 2",
+		src:     `{"A":1,"a":2}`,
+		path:    `$.(toUpperKeys)`,
+		want:    map[string]interface{}{"A": float64(2)},
+		wantErr: false,
+	}, {
+		name:    "toLowerKeys 3",
+		src:     `[{"A":1}]`,
+		path:    `$.(toLowerKeys)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "flattenDeep 1",
+		src:     `[1,[2,[3,[4]],5],[],[[[]]],{"a":[6]},"x"]`,
+		path:    `$.(flattenDeep)`,
+		want:    []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5), map[string]interface{}{"a": []interface{}{float64(6)}}, "x"},
+		wantErr: false,
+	}, {
+		name:    "flattenDeep 2",
+		src:     `[]`,
+		path:    `$.(flattenDeep)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "flattenDeep 3",
+		src:     `{"a":[1]}`,
+		path:    `$.(flattenDeep)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "round 1",
+		src:     `[1.5,-1.5,2.4,-2.6]`,
+		path:    `$[0].(round)`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "round 2",
+		src:     `[1.5,-1.5,2.4,-2.6]`,
+		path:    `$[1].(round)`,
+		want:    float64(-2),
+		wantErr: false,
+	}, {
+		name:    "mapValues 1",
+		src:     `{"prices":{"a":1.25,"b":2.5,"c":-0.4}}`,
+		path:    `$.prices.(mapValues 'round')`,
+		want:    map[string]interface{}{"a": float64(1), "b": float64(3), "c": float64(0)},
+		wantErr: false,
+	}, {
+		name:    "mapValues 2",
+		src:     `[1.5,-1.5,2.4,-2.6]`,
+		path:    `$.(mapValues "round")`,
+		want:    []interface{}{float64(2), float64(-2), float64(2), float64(-3)},
+		wantErr: false,
+	}, {
+		name:    "mapValues 3",
+		src:     `{"a":[1,2],"b":[]}`,
+		path:    `$.(mapValues 'length')`,
+		want:    map[string]interface{}{"a": 2, "b": 0},
+		wantErr: false,
+	}, {
+		name:    "mapValues 4",
+		src:     `{"a":1.5,"b":"x"}`,
+		path:    `$.(mapValues 'round')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mapValues 5",
+		src:     `{"a":1.5}`,
+		path:    `$.(mapValues 'undefinedFunction')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mapValues 6",
+		src:     `{"a":[1]}`,
+		path:    `$.(mapValues 'take')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mapValues 7",
+		src:     `{"a":1.5}`,
+		path:    `$.(mapValues 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "depthOf 1",
+		src:     `{"s":"x","e":[],"o":{"a":1,"b":2},"n":{"a":[1,{"b":[[]]}],"c":1}}`,
+		path:    `$.s.(depthOf)`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "depthOf 2",
+		src:     `{"s":"x","e":[],"o":{"a":1,"b":2},"n":{"a":[1,{"b":[[]]}],"c":1}}`,
+		path:    `$.e.(depthOf)`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "depthOf 3",
+		src:     `{"s":"x","e":[],"o":{"a":1,"b":2},"n":{"a":[1,{"b":[[]]}],"c":1}}`,
+		path:    `$.o.(depthOf)`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "depthOf 4",
+		src:     `{"s":"x","e":[],"o":{"a":1,"b":2},"n":{"a":[1,{"b":[[]]}],"c":1}}`,
+		path:    `$.n.(depthOf)`,
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "depthOf 5",
+		src:     `{"s":"x","e":[],"o":{"a":1,"b":2},"n":{"a":[1,{"b":[[]]}],"c":1}}`,
+		path:    `$.(depthOf)`,
+		want:    float64(6),
+		wantErr: false,
+	}, {
+		name:    "sumOf 1",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(sumOf 'total')`,
+		want:    float64(20),
+		wantErr: false,
+	}, {
+		name:    "avgOf 1",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(avgOf 'total')`,
+		want:    float64(20) / 3,
+		wantErr: false,
+	}, {
+		name:    "sumOf 2",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(sumOf '@.p.t')`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "avgOf 2",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(avgOf '@.p.t')`,
+		want:    float64(1.5),
+		wantErr: false,
+	}, {
+		name:    "sumOf 3",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.empty.(sumOf 'total')`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "avgOf 3",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.empty.(avgOf 'total')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "sumOf 4",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.bad.(sumOf 'total')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "sumOf 5",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(sumOf '@..t')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "sumOf 6",
+		src:     `{"orders":[{"total":10,"p":{"t":1}},{"total":2.5,"p":{"t":2}},{"id":3},{"total":7.5}],"bad":[{"total":"1"}],"empty":[]}`,
+		path:    `$.orders.(sumOf 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "first predicate 1",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(first @.active == true).id`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "first predicate 2",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(first @.id > 3).id`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "first predicate 3",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(first @.id > 4)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "last predicate 1",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(last @.active == false).id`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "last predicate 2",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(last @.id < 2).id`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "last predicate 3",
+		src:     `{"items":[{"id":1,"active":true},{"id":2,"active":false},{"id":3,"active":true},{"id":4,"active":false}]}`,
+		path:    `$.items.(last @.id == 0)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "format 1",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format '{firstName} {lastName}')`,
+		want:    "Ada Lovelace",
+		wantErr: false,
+	}, {
+		name:    "format 2",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format 'age={age}, ratio={ratio}, ok={ok}, n={n}')`,
+		want:    "age=36, ratio=1.5, ok=true, n=null",
+		wantErr: false,
+	}, {
+		name:    "format 3",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format '[{middleName}]{{{firstName}}}')`,
+		want:    "[]{Ada}",
+		wantErr: false,
+	}, {
+		name:    "format 4",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format '')`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "format 5",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format '{o}')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "format 6",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format '{firstName')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "format 7",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.u.(format 'a}')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "format 8",
+		src:     `{"u":{"firstName":"Ada","lastName":"Lovelace","age":36,"ratio":1.5,"ok":true,"n":null,"o":{}},"a":[]}`,
+		path:    `$.a.(format '{a}')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "countMatching 1",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.events.(countMatching @.level == 'error')`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "countMatching 2",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.events.(countMatching @.level == 'debug')`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "countMatching 3",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.errors.(countMatching @.level == 'error')`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "countMatching 4",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.empty.(countMatching @.level == 'error')`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "countMatching 5",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.o.(countMatching @.level == 'error')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "countMatching 6",
+		src:     `{"events":[{"level":"error"},{"level":"info"},{"level":"error"}],"errors":[{"level":"error"}],"empty":[],"o":{}}`,
+		path:    `$.events.(countMatching)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "any 1",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.none.(any @.v == true)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "any 2",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.some.(any @.v == true)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "any 3",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.every.(any @.v == true)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "any 4",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.empty.(any @.v == true)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "all 1",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.none.(all @.v == true)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "all 2",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.some.(all @.v == true)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "all 3",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.every.(all @.v == true)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "all 4",
+		src:     `{"none":[{"v":false},{"v":false}],"some":[{"v":true},{"v":false}],"every":[{"v":true},{"v":true}],"empty":[]}`,
+		path:    `$.empty.(all @.v == true)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "reverse 1",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(reverse)`,
+		want:    []interface{}{map[string]interface{}{"id": float64(3)}, map[string]interface{}{"id": float64(2)}, map[string]interface{}{"id": float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "reverse 2",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.empty.(reverse)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "chained 1",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(reverse)(first).id`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "chained 2",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(reverse)(take 2)[1].id`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "chained 3",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(drop 1)(reverse)(first @.id < 3).id`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "chained 4",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items(first)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "chained 5",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items[0](length)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "chained 6",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(reverse) (first)`,
+		want:    map[string]interface{}{"id": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "chained 7",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items.(drop 1)` + "\n\t" + `(reverse) (first).id`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "chained 8",
+		src:     `{"items":[{"id":1},{"id":2},{"id":3}],"empty":[]}`,
+		path:    `$.items (first)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromJSONString 1",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.payload.(fromJSONString).id`,
+		want:    float64(7),
+		wantErr: false,
+	}, {
+		name:    "fromJSONString 2",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.payload.(fromJSONString).items[0].n`,
+		want:    "a",
+		wantErr: false,
+	}, {
+		name:    "fromJSONString 3",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.num.(fromJSONString)`,
+		want:    float64(1.5),
+		wantErr: false,
+	}, {
+		name:    "fromJSONString 4",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.nested.(fromJSONString)(fromJSONString).a`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "fromJSONString 5",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.bad.(fromJSONString)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromJSONString 6",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.obj.(fromJSONString)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromJSONString 7",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.n.(fromJSONString)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromJSONString 8",
+		src:     `{"payload":"{\"id\":7,\"items\":[{\"n\":\"a\"}]}","num":"1.5","nested":"\"{\\\"a\\\":1}\"","bad":"{\"id\":","obj":{"id":1},"n":1}`,
+		path:    `$.obj.(toJSONString)(fromJSONString).id`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "minBy 1",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.products.(minBy 'price').id`,
+		want:    "b",
+		wantErr: false,
+	}, {
+		name:    "maxBy 1",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.products.(maxBy 'price').id`,
+		want:    "c",
+		wantErr: false,
+	}, {
+		name:    "minBy 2",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.products.(minBy '@.s.n').id`,
+		want:    "c",
+		wantErr: false,
+	}, {
+		name:    "maxBy 2",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.products.(maxBy '@.s.n').id`,
+		want:    "b",
+		wantErr: false,
+	}, {
+		name:    "minBy 3",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.empty.(minBy 'price')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "maxBy 3",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.bad.(maxBy 'price')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "minBy 4",
+		src:     `{"products":[{"id":"a","price":30,"s":{"n":2}},{"id":"b","price":10,"s":{"n":9}},{"id":"c","price":50,"s":{"n":1}},{"id":"d","price":10,"s":{"n":9}}],"bad":[{"price":1},{"price":"2"}],"missing":[{"price":1},{}],"empty":[]}`,
+		path:    `$.missing.(minBy 'price')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "formatNumber 1",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.up.(formatNumber 2)`,
+		want:    "1.24",
+		wantErr: false,
+	}, {
+		name:    "formatNumber 2",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.down.(formatNumber 2)`,
+		want:    "1.23",
+		wantErr: false,
+	}, {
+		name:    "formatNumber 3",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.r.(formatNumber 0)`,
+		want:    "3",
+		wantErr: false,
+	}, {
+		name:    "formatNumber 4",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.i.(formatNumber 2)`,
+		want:    "3.00",
+		wantErr: false,
+	}, {
+		name:    "formatNumber 5",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.neg.(formatNumber 1)`,
+		want:    "-0.1",
+		wantErr: false,
+	}, {
+		name:    "formatNumber 6",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.s.(formatNumber 2)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "formatNumber 7",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.up.(formatNumber -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "formatNumber 8",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.up.(formatNumber 1.5)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "formatNumber 9",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.i.(formatNumber 100)`,
+		want:    "3." + strings.Repeat("0", 100),
+		wantErr: false,
+	}, {
+		name:    "formatNumber 10",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.i.(formatNumber 101)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "formatNumber 11",
+		src:     `{"up":1.236,"down":1.234,"r":2.7,"i":3,"neg":-0.125,"s":"1.5"}`,
+		path:    `$.i.(formatNumber 1e9)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "countBy 1",
+		src:     `{"events":[{"type":"click"},{"type":"view"},{"type":"click"},{"id":1},{"type":null},{"type":1},{"type":"1"},{"type":true}],"bad":[{"type":[]}],"empty":[]}`,
+		path:    `$.events.(countBy 'type')`,
+		want:    map[string]interface{}{"click": float64(2), "view": float64(1), "null": float64(1), "1": float64(2), "true": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "countBy 2",
+		src:     `{"events":[{"type":"click"},{"type":"view"},{"type":"click"},{"id":1},{"type":null},{"type":1},{"type":"1"},{"type":true}],"bad":[{"type":[]}],"empty":[]}`,
+		path:    `$.events.(countBy 'type').click`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "countBy 3",
+		src:     `{"events":[{"type":"click"},{"type":"view"},{"type":"click"},{"id":1},{"type":null},{"type":1},{"type":"1"},{"type":true}],"bad":[{"type":[]}],"empty":[]}`,
+		path:    `$.empty.(countBy 'type')`,
+		want:    map[string]interface{}{},
+		wantErr: false,
+	}, {
+		name:    "countBy 4",
+		src:     `{"events":[{"type":"click"},{"type":"view"},{"type":"click"},{"id":1},{"type":null},{"type":1},{"type":"1"},{"type":true}],"bad":[{"type":[]}],"empty":[]}`,
+		path:    `$.bad.(countBy 'type')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "distinctCount 1",
+		src:     `{"uniq":[1,"1",true,null,"a"],"dup":[1,1.0,"a","a",null,null,false,true,false],"empty":[],"bad":[1,[1]]}`,
+		path:    `$.uniq.(distinctCount)`,
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "distinctCount 2",
+		src:     `{"uniq":[1,"1",true,null,"a"],"dup":[1,1.0,"a","a",null,null,false,true,false],"empty":[],"bad":[1,[1]]}`,
+		path:    `$.dup.(distinctCount)`,
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "distinctCount 3",
+		src:     `{"uniq":[1,"1",true,null,"a"],"dup":[1,1.0,"a","a",null,null,false,true,false],"empty":[],"bad":[1,[1]]}`,
+		path:    `$.empty.(distinctCount)`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "distinctCount 4",
+		src:     `{"uniq":[1,"1",true,null,"a"],"dup":[1,1.0,"a","a",null,null,false,true,false],"empty":[],"bad":[1,[1]]}`,
+		path:    `$.bad.(distinctCount)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "toInt 1",
+		src:     `{"p":2.9,"n":-2.9,"i":3,"z":-0.5,"s":"1"}`,
+		path:    `$.p.(toInt)`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "toInt 2",
+		src:     `{"p":2.9,"n":-2.9,"i":3,"z":-0.5,"s":"1"}`,
+		path:    `$.n.(toInt)`,
+		want:    float64(-2),
+		wantErr: false,
+	}, {
+		name:    "toInt 3",
+		src:     `{"p":2.9,"n":-2.9,"i":3,"z":-0.5,"s":"1"}`,
+		path:    `$.i.(toInt)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "toInt 4",
+		src:     `{"p":2.9,"n":-2.9,"i":3,"z":-0.5,"s":"1"}`,
+		path:    `$.z.(toInt)(toJSONString)`,
+		want:    "0",
+		wantErr: false,
+	}, {
+		name:    "toInt 5",
+		src:     `{"p":2.9,"n":-2.9,"i":3,"z":-0.5,"s":"1"}`,
+		path:    `$.s.(toInt)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "keysCount 1",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.o.(keysCount)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "keysCount 2",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.e.(keysCount)`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "keysCount 3",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.arr.(keysCount)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "deepLeafCount 1",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.o.(deepLeafCount)`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "deepLeafCount 2",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.arr.(deepLeafCount)`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "deepLeafCount 3",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.e.(deepLeafCount)`,
+		want:    float64(0),
+		wantErr: false,
+	}, {
+		name:    "deepLeafCount 4",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.s.(deepLeafCount)`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "deepLeafCount 5",
+		src:     `{"o":{"a":1,"b":{"c":[1,2,{"d":null}],"e":{}},"f":[]},"e":{},"s":"x","arr":[[1],[[2,3]]]}`,
+		path:    `$.(deepLeafCount)`,
+		want:    float64(8),
+		wantErr: false,
+	}, {
+		name:    "flatMap 1",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.orders.(flatMap 'items')`,
+		want:    []interface{}{float64(1), float64(2), float64(3), []interface{}{float64(5)}},
+		wantErr: false,
+	}, {
+		name:    "flatMap 2",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.orders.(flatMap '@.d.items')`,
+		want:    []interface{}{float64(6), float64(7)},
+		wantErr: false,
+	}, {
+		name:    "flatMap 3",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.empty.(flatMap 'items')`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "flatMap 4",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.bad.(flatMap 'items')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "flatMap 5",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.orders.(flatMap 'items')(length)`,
+		want:    4,
+		wantErr: false,
+	}, {
+		name:    "flatMap 6",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.orders.(flatMap '$.items')`,
+		want:    []interface{}{float64(1), float64(2), float64(3), []interface{}{float64(5)}},
+		wantErr: false,
+	}, {
+		name:    "flatMap 7",
+		src:     `{"orders":[[1,2],[],[[4]]]}`,
+		path:    `$.orders.(flatMap '$')`,
+		want:    []interface{}{float64(1), float64(2), []interface{}{float64(4)}},
+		wantErr: false,
+	}, {
+		name:    "flatMap 8",
+		src:     `{"orders":[{"items":[1,2]},{"items":[]},{"items":[3]},{"id":4},{"items":[[5]],"d":{"items":[6,7]}}],"bad":[{"items":1}],"empty":[]}`,
+		path:    `$.orders.(flatMap '@.items')`,
+		want:    []interface{}{float64(1), float64(2), float64(3), []interface{}{float64(5)}},
+		wantErr: false,
+	}, {
+		name:    "flatMap 9",
+		src:     `{"orders":[{"$items":[1,2]},{"$items":[3]}]}`,
+		path:    `$.orders.(flatMap '$items')`,
+		want:    []interface{}{float64(1), float64(2), float64(3)},
+		wantErr: false,
+	}, {
+		name:    "firstNonNull 1",
+		src:     `{"lead":[null,null,{"id":1},2],"none":[false,null],"all":[null,null],"empty":[]}`,
+		path:    `$.lead.(firstNonNull).id`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "firstNonNull 2",
+		src:     `{"lead":[null,null,{"id":1},2],"none":[false,null],"all":[null,null],"empty":[]}`,
+		path:    `$.none.(firstNonNull)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "firstNonNull 3",
+		src:     `{"lead":[null,null,{"id":1},2],"none":[false,null],"all":[null,null],"empty":[]}`,
+		path:    `$.all.(firstNonNull)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "firstNonNull 4",
+		src:     `{"lead":[null,null,{"id":1},2],"none":[false,null],"all":[null,null],"empty":[]}`,
+		path:    `$.empty.(firstNonNull)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "in 1",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.status.(in 'open' 'pending' 'review')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "in 2",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.closed.(in 'open' 'pending' 'review')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "in 3",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.status.(in)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "in 4",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.n.(in 1 2.0 3)`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "in 5",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.n.(in '2')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "in 6",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.s1.(in 1)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "in 7",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.t.(in 'true' 1)`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "in 8",
+		src:     `{"status":"open","closed":"closed","n":2,"s1":"1","t":true,"o":{}}`,
+		path:    `$.o.(in 'a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "equals 1",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.config.(equals '{"a":1.0,"b":[1,{"c":null}]}')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "equals 2",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.config.(equals '{"a":1,"b":[{"c":null},1]}')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "equals 3",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.config.(equals '{"a":1}')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "equals 4",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.n.(equals '1')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "equals 5",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.s.(equals '"x"')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "equals 6",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.s.(equals 'x')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "equals 7",
+		src:     `{"config":{"b":[1,{"c":null}],"a":1},"n":1.0,"s":"x"}`,
+		path:    `$.s.(equals 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "percentile 1",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile 50)`,
+		want:    float64(35),
+		wantErr: false,
+	}, {
+		name:    "percentile 2",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile 30)`,
+		want:    float64(20),
+		wantErr: false,
+	}, {
+		name:    "percentile 3",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile 100)`,
+		want:    float64(50),
+		wantErr: false,
+	}, {
+		name:    "percentile 4",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile 0)`,
+		want:    float64(15),
+		wantErr: false,
+	}, {
+		name:    "percentile 5",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.d.(percentile 95)`,
+		want:    float64(19),
+		wantErr: false,
+	}, {
+		name:    "percentile 6",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.d.(percentile 50)`,
+		want:    float64(10),
+		wantErr: false,
+	}, {
+		name:    "percentile 7",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.one.(percentile 95)`,
+		want:    float64(7),
+		wantErr: false,
+	}, {
+		name:    "percentile 8",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.bad.(percentile 50)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "percentile 9",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.empty.(percentile 50)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "percentile 10",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile 101)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "percentile 11",
+		src:     `{"l":[15,20,35,40,50],"d":[1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20],"one":[7],"bad":[1,"2"],"empty":[]}`,
+		path:    `$.l.(percentile -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "merge 1",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.(merge '$.defaults' '$.overrides')`,
+		want:    map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"y": float64(2)}, "c": nil, "d": float64(4)},
+		wantErr: false,
+	}, {
+		name:    "merge 2",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.(merge '$.defaults' '$.other')`,
+		want:    map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"x": float64(1)}, "c": float64(3), "e": float64(5)},
+		wantErr: false,
+	}, {
+		name:    "merge 3",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.arr.(merge '$.other' '$.overrides' '$.other')`,
+		want:    map[string]interface{}{"b": map[string]interface{}{"y": float64(2)}, "c": nil, "d": float64(4), "e": float64(5)},
+		wantErr: false,
+	}, {
+		name:    "merge 4",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.(merge '$.defaults' '$.arr')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "merge 5",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.(merge '$.defaults' '$.missing')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "merge 6",
+		src:     `{"defaults":{"a":1,"b":{"x":1},"c":3},"overrides":{"b":{"y":2},"c":null,"d":4},"other":{"e":5},"arr":[1]}`,
+		path:    `$.(merge '$.defaults')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "mergeDeep 1",
+		src:     `{"base":{"a":1,"b":{"x":1,"y":{"p":1,"q":2},"z":[1,2]},"c":{"k":1}},"patch":{"b":{"y":{"q":3,"r":4},"z":[3]},"c":null,"d":{"e":5}},"arr":[1]}`,
+		path:    `$.(mergeDeep '$.base' '$.patch')`,
+		want:    map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"x": float64(1), "y": map[string]interface{}{"p": float64(1), "q": float64(3), "r": float64(4)}, "z": []interface{}{float64(3)}}, "c": nil, "d": map[string]interface{}{"e": float64(5)}},
+		wantErr: false,
+	}, {
+		name:    "mergeDeep 2",
+		src:     `{"base":{"a":1,"b":{"x":1,"y":{"p":1,"q":2},"z":[1,2]},"c":{"k":1}},"patch":{"b":{"y":{"q":3,"r":4},"z":[3]},"c":null,"d":{"e":5}},"arr":[1]}`,
+		path:    `$.(mergeDeep '$.base' '$.patch' '$.base').b.y`,
+		want:    map[string]interface{}{"p": float64(1), "q": float64(2), "r": float64(4)},
+		wantErr: false,
+	}, {
+		name:    "mergeDeep 3",
+		src:     `{"base":{"a":1,"b":{"x":1,"y":{"p":1,"q":2},"z":[1,2]},"c":{"k":1}},"patch":{"b":{"y":{"q":3,"r":4},"z":[3]},"c":null,"d":{"e":5}},"arr":[1]}`,
+		path:    `$.(mergeDeep '$.patch' '$.arr')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "substr 1",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 0 3)`,
+		want:    "abc",
+		wantErr: false,
+	}, {
+		name:    "substr 2",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 2)`,
+		want:    "cdef",
+		wantErr: false,
+	}, {
+		name:    "substr 3",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.j.(substr 1 2)`,
+		want:    "本語",
+		wantErr: false,
+	}, {
+		name:    "substr 4",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.j.(substr 3)`,
+		want:    "テキスト",
+		wantErr: false,
+	}, {
+		name:    "substr 5",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 4 10)`,
+		want:    "ef",
+		wantErr: false,
+	}, {
+		name:    "substr 6",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 10 2)`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "substr 7",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 1 0)`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "substr 8",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "substr 9",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr 1.5)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "substr 10",
+		src:     `{"a":"abcdef","j":"日本語テキスト"}`,
+		path:    `$.a.(substr)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padStart 1",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padStart 5 '0')`,
+		want:    "00042",
+		wantErr: false,
+	}, {
+		name:    "padStart 2",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.b.(padStart 3 '0')`,
+		want:    "12345",
+		wantErr: false,
+	}, {
+		name:    "padStart 3",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.j.(padStart 4 '＊')`,
+		want:    "＊＊日本",
+		wantErr: false,
+	}, {
+		name:    "padStart 4",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padStart 5 'ab')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padStart 5",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padStart 5 '')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padStart 6",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padStart 5)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padStart 7",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padStart 16777217 'x')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padEnd 1",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padEnd 4 ' ')`,
+		want:    "42  ",
+		wantErr: false,
+	}, {
+		name:    "padEnd 2",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.b.(padEnd 5 ' ')`,
+		want:    "12345",
+		wantErr: false,
+	}, {
+		name:    "padEnd 3",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padEnd -1 ' ')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "padEnd 4",
+		src:     `{"a":"42","b":"12345","j":"日本"}`,
+		path:    `$.a.(padEnd 1e12 'x')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dateFormat 1",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateFormat '2006-01-02')`,
+		want:    "2023-04-05",
+		wantErr: false,
+	}, {
+		name:    "dateFormat 2",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateFormat 'Jan 2, 2006 15:04 MST-07:00')`,
+		want:    "Apr 5, 2023 06:07 +0900+09:00",
+		wantErr: false,
+	}, {
+		name:    "dateFormat 3",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.x.(dateFormat '2006-01-02')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dateFormat 4",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateFormat 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dateAdd 1",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateAdd '24h')`,
+		want:    "2023-04-06T06:07:08+09:00",
+		wantErr: false,
+	}, {
+		name:    "dateAdd 2",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.u.(dateAdd '-6h30m')`,
+		want:    "2023-04-04T23:37:08.25Z",
+		wantErr: false,
+	}, {
+		name:    "dateAdd 3",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateAdd '1d')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dateAdd 4",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.x.(dateAdd '1h')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "dateAdd 5",
+		src:     `{"t":"2023-04-05T06:07:08+09:00","u":"2023-04-05T06:07:08.25Z","x":"2023/04/05"}`,
+		path:    `$.t.(dateAdd '24h').(dateFormat '2006-01-02')`,
+		want:    "2023-04-06",
+		wantErr: false,
+	}, {
+		name:    "trimPrefix 1",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.id.(trimPrefix 'user_')`,
+		want:    "42",
+		wantErr: false,
+	}, {
+		name:    "trimPrefix 2",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.file.(trimPrefix 'user_')`,
+		want:    "a.json",
+		wantErr: false,
+	}, {
+		name:    "trimPrefix 3",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.e.(trimPrefix 'user_')`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "trimPrefix 4",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.id.(trimPrefix 1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "trimSuffix 1",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.file.(trimSuffix '.json')`,
+		want:    "a",
+		wantErr: false,
+	}, {
+		name:    "trimSuffix 2",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.id.(trimSuffix '.json')`,
+		want:    "user_42",
+		wantErr: false,
+	}, {
+		name:    "trimSuffix 3",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.e.(trimSuffix '.json')`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "trimSuffix 4",
+		src:     `{"id":"user_42","file":"a.json","e":""}`,
+		path:    `$.file.(trimSuffix '.json' '.yaml')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "typeIs 1",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.n.(typeIs 'number')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "typeIs 2",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.s.(typeIs 'number')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "typeIs 3",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.z.(typeIs 'null')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "typeIs 4",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.z.(typeIs 'object')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "typeIs 5",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.b.(typeIs 'boolean')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "typeIs 6",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.o.(typeIs 'object')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "typeIs 7",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.a.(typeIs 'object')`,
+		want:    false,
+		wantErr: false,
+	}, {
+		name:    "typeIs 8",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.a.(length).(typeIs 'number')`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "typeIs 9",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.n.(typeIs 'integer')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "typeIs 10",
+		src:     `{"n":1,"s":"x","b":false,"z":null,"o":{},"a":[]}`,
+		path:    `$.n.(typeIs)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "compact 1",
+		src:     `{"a":[1,null,"",{},[],"x",0,false,{"k":null},[null],"  "]}`,
+		path:    `$.a.(compact)`,
+		want:    []interface{}{float64(1), "x", float64(0), false, map[string]interface{}{"k": nil}, []interface{}{nil}, "  "},
+		wantErr: false,
+	}, {
+		name:    "compact 2",
+		src:     `{"a":[null,"",{},[]]}`,
+		path:    `$.a.(compact)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "compact 3",
+		src:     `{"a":[]}`,
+		path:    `$.a.(compact)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 1",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"old":"new","a":"b"}')`,
+		want:    map[string]interface{}{"new": float64(1), "b": float64(2), "c": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 2",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"x":"y"}')`,
+		want:    map[string]interface{}{"old": float64(1), "a": float64(2), "c": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 3",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"a":"c"}')`,
+		want:    map[string]interface{}{"old": float64(1), "c": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 4",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"c":"a"}')`,
+		want:    map[string]interface{}{"old": float64(1), "a": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 5",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"a":"c","c":"a"}')`,
+		want:    map[string]interface{}{"old": float64(1), "c": float64(2), "a": float64(3)},
+		wantErr: false,
+	}, {
+		name:    "renameKeys 6",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"a":1}')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "renameKeys 7",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '["a"]')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "renameKeys 8",
+		src:     `{"r":{"old":1,"a":2,"c":3}}`,
+		path:    `$.r.(renameKeys '{"a":')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 1",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat 3)`,
+		want:    "ababab",
+		wantErr: false,
+	}, {
+		name:    "repeat 2",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.item.(repeat 2)`,
+		want:    []interface{}{map[string]interface{}{"id": float64(1)}, map[string]interface{}{"id": float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "repeat 3",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.arr.(repeat 2)`,
+		want:    []interface{}{[]interface{}{float64(1)}, []interface{}{float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "repeat 4",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.n.(repeat 3)`,
+		want:    []interface{}{nil, nil, nil},
+		wantErr: false,
+	}, {
+		name:    "repeat 5",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat 0)`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "repeat 6",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.item.(repeat 0)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "repeat 7",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat -1)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 8",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat 1.5)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 9",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 10",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat 9000000000000000000)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 11",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.arr.(repeat 9000000000000000000)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 12",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.ch.(repeat 16777216)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 13",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.e.(repeat 16777216)`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "repeat 14",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.n.(repeat 16777216)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 15",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1,2,3,4],"e":"","n":null}`,
+		path:    `$.arr.(repeat 262145)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "repeat 16",
+		src:     `{"ch":"ab","item":{"id":1},"arr":[1],"e":"","n":null}`,
+		path:    `$.arr.(repeat 1048576)(length)`,
+		want:    1048576,
+		wantErr: false,
+	}, {
+		name:    "union 1",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a' '$.b')`,
+		want:    []interface{}{float64(1), "x", float64(2), float64(3), nil},
+		wantErr: false,
+	}, {
+		name:    "union 2",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a' '$.c')`,
+		want:    []interface{}{float64(1), "x", float64(2), float64(4), float64(5)},
+		wantErr: false,
+	}, {
+		name:    "union 3",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.c' '$.b' '$.a')`,
+		want:    []interface{}{float64(4), float64(5), float64(2), float64(3), "x", nil, float64(1)},
+		wantErr: false,
+	}, {
+		name:    "union 4",
+		src:     `{"a":[1,"x",2,1],"b":[],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.b' '$.b')`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "union 5",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a' '$.o')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "union 6",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a' '$.n')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "union 7",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "union 8",
+		src:     `{"a":[1,"x",2,1],"b":[2,3,"x",null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(union '$.a' '$.missing')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "intersect 1",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.a' '$.b')`,
+		want:    []interface{}{float64(1), float64(2), nil},
+		wantErr: false,
+	}, {
+		name:    "intersect 2",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.a' '$.a')`,
+		want:    []interface{}{float64(3), "x", float64(1), float64(2), nil},
+		wantErr: false,
+	}, {
+		name:    "intersect 3",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.a' '$.c')`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "intersect 4",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.a' '$.o')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "intersect 5",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.n' '$.a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "intersect 6",
+		src:     `{"a":[3,"x",1,2,1,null],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(intersect '$.a' '$.b' '$.c')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "difference 1",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.a' '$.b')`,
+		want:    []interface{}{float64(3), "x"},
+		wantErr: false,
+	}, {
+		name:    "difference 2",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.a' '$.c')`,
+		want:    []interface{}{float64(3), "x", float64(1), float64(2), nil},
+		wantErr: false,
+	}, {
+		name:    "difference 3",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.a' '$.a')`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "difference 4",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.o' '$.a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "difference 5",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.a' '$.n')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "difference 6",
+		src:     `{"a":[3,"x",1,2,1,null,3],"b":[2,1.0,4,null],"c":[4,5],"o":{"k":1},"n":[{"k":1}]}`,
+		path:    `$.(difference '$.a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "toEntries 1",
+		src:     `{"obj":{"b":1,"a":{"x":null}},"e":{},"arr":[]}`,
+		path:    `$.obj.(toEntries)`,
+		want:    []interface{}{map[string]interface{}{"key": "a", "value": map[string]interface{}{"x": nil}}, map[string]interface{}{"key": "b", "value": float64(1)}},
+		wantErr: false,
+	}, {
+		name:    "toEntries 2",
+		src:     `{"obj":{"b":1,"a":{"x":null}},"e":{},"arr":[]}`,
+		path:    `$.e.(toEntries)`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "toEntries 3",
+		src:     `{"obj":{"b":1,"a":{"x":null}},"e":{},"arr":[]}`,
+		path:    `$.arr.(toEntries)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromEntries 1",
+		src:     `{"ents":[{"key":"b","value":1},{"key":"a","value":null},{"key":"b","value":2}],"e":[]}`,
+		path:    `$.ents.(fromEntries)`,
+		want:    map[string]interface{}{"a": nil, "b": float64(2)},
+		wantErr: false,
+	}, {
+		name:    "fromEntries 2",
+		src:     `{"ents":[{"key":"b","value":1},{"key":"a","value":null},{"key":"b","value":2}],"e":[]}`,
+		path:    `$.e.(fromEntries)`,
+		want:    map[string]interface{}{},
+		wantErr: false,
+	}, {
+		name:    "fromEntries 3",
+		src:     `{"ents":[{"key":1,"value":1}]}`,
+		path:    `$.ents.(fromEntries)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromEntries 4",
+		src:     `{"ents":[{"key":"a"}]}`,
+		path:    `$.ents.(fromEntries)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromEntries 5",
+		src:     `{"ents":[["a",1]]}`,
+		path:    `$.ents.(fromEntries)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "fromEntries 6",
+		src:     `{"obj":{"b":1,"a":{"x":[1]}}}`,
+		path:    `$.obj.(toEntries).(fromEntries)`,
+		want:    map[string]interface{}{"a": map[string]interface{}{"x": []interface{}{float64(1)}}, "b": float64(1)},
+		wantErr: false,
+	}, {
+		name:    "hash 1",
+		src:     `{"config":{"b":[true,null],"a":1.0},"s":"x","n":null}`,
+		path:    `$.config.(hash)`,
+		want:    "1cc69c7fa23616ca2ec3ee70d24390a6225c8832db8a4c814c7e0e7f942f8668",
+		wantErr: false,
+	}, {
+		name:    "hash 2",
+		src:     `{"config":{"b":[true,null],"a":1.0},"s":"x","n":null}`,
+		path:    `$.s.(hash)`,
+		want:    "ba2df4903a2c14e86dc3bcca58911b44ac1d2514b7227bf6eb08cfb978f55a1b",
+		wantErr: false,
+	}, {
+		name:    "hash 3",
+		src:     `{"config":{"b":[true,null],"a":1.0},"s":"x","n":null}`,
+		path:    `$.n.(hash)`,
+		want:    "74234e98afe7498fb5daf1f36ac2d78acc339464f950703b8c019892f982b90b",
+		wantErr: false,
+	}, {
+		name:    "hash 4",
+		src:     `{"config":{"b":[true,null],"a":1.0},"s":"x","n":null}`,
+		path:    `$.s.(hash 'sha1')`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				var v interface{}
+				v, err = path.Query(json)
+				if err == nil {
+					if tt.wantErr {
+						t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+						return
+					}
+					if !reflect.DeepEqual(v, tt.want) {
+						t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					}
+					return
+				}
+			}
+
+			if !tt.wantErr {
+				t.Errorf("%v: error = %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestMapKeysDoesNotModifySource(t *testing.T) {
+	json, err := jsonpath.ReadString(`{"old":1}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	path, err := jsonpath.Compile(`$.(mapKeys 'old' 'new')`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	if _, err := path.Query(json); err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+
+	want := map[string]interface{}{"old": float64(1)}
+	if !reflect.DeepEqual(json.Root(), want) {
+		t.Errorf("v = %v, want = %v", json.Root(), want)
+	}
+}
+
+func TestFunctionNotApplicable(t *testing.T) {
+	const src = `{"null":null,"number":1,"string":"x","boolean":true,"object":{"a":1},"array":[1]}`
+
+	tests := []struct {
+		fn         string
+		applicable []string
+	}{
+		{fn: `length`, applicable: []string{"array"}},
+		{fn: `first`, applicable: []string{"array"}},
+		{fn: `last`, applicable: []string{"array"}},
+		{fn: `coalesceKeys 'a'`, applicable: []string{"object"}},
+		{fn: `take 1`, applicable: []string{"array"}},
+		{fn: `drop 1`, applicable: []string{"array"}},
+		{fn: `page 1 1`, applicable: []string{"array"}},
+		{fn: `clamp 0 1`, applicable: []string{"number"}},
+		{fn: `startsWithArr '$.array'`, applicable: []string{"array"}},
+		{fn: `toLowerKeys`, applicable: []string{"object"}},
+		{fn: `toUpperKeys`, applicable: []string{"object"}},
+		{fn: `renameKeys '{}'`, applicable: []string{"object"}},
+		{fn: `flattenDeep`, applicable: []string{"array"}},
+		{fn: `round`, applicable: []string{"number"}},
+		{fn: `sumOf 'a'`, applicable: []string{"array"}},
+		{fn: `avgOf 'a'`, applicable: []string{"array"}},
+		{fn: `format '{a}'`, applicable: []string{"object"}},
+		{fn: `substr 1`, applicable: []string{"string"}},
+		{fn: `padStart 3 '0'`, applicable: []string{"string"}},
+		{fn: `padEnd 3 '0'`, applicable: []string{"string"}},
+		{fn: `trimPrefix 'a'`, applicable: []string{"string"}},
+		{fn: `trimSuffix 'a'`, applicable: []string{"string"}},
+		{fn: `repeat 2`, applicable: []string{"null", "boolean", "number", "string", "object", "array"}},
+		{fn: `reverse`, applicable: []string{"array"}},
+		{fn: `toJSONString`, applicable: []string{"null", "boolean", "number", "string", "object", "array"}},
+		{fn: `hash`, applicable: []string{"null", "boolean", "number", "string", "object", "array"}},
+		{fn: `fromJSONString`, applicable: []string{"string"}},
+		{fn: `minBy 'a'`, applicable: []string{"array"}},
+		{fn: `formatNumber 2`, applicable: []string{"number"}},
+		{fn: `countBy 'a'`, applicable: []string{"array"}},
+		{fn: `distinctCount`, applicable: []string{"array"}},
+		{fn: `toInt`, applicable: []string{"number"}},
+		{fn: `keysCount`, applicable: []string{"object"}},
+		{fn: `flatMap 'a'`, applicable: []string{"array"}},
+		{fn: `firstNonNull`, applicable: []string{"array"}},
+		{fn: `compact`, applicable: []string{"array"}},
+		{fn: `percentile 50`, applicable: []string{"array"}},
+		{fn: `merge '$.object' '$.object'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `mergeDeep '$.object' '$.object'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `union '$.array' '$.array'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `intersect '$.array' '$.array'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `difference '$.array' '$.array'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `toEntries`, applicable: []string{"object"}},
+		{fn: `fromEntries`, applicable: []string{"array"}},
+		{fn: `in 1`, applicable: []string{"null", "number", "string", "boolean"}},
+		{fn: `equals '1'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `deepLeafCount`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `maxBy 'a'`, applicable: []string{"array"}},
+		{fn: `countMatching @ == 1`, applicable: []string{"array"}},
+		{fn: `any @ == 1`, applicable: []string{"array"}},
+		{fn: `all @ == 1`, applicable: []string{"array"}},
+		{fn: `mapValues 'head'`, applicable: []string{"object", "array"}},
+		{fn: `chunk 1`, applicable: []string{"array"}},
+		{fn: `mapKeys 'a' 'b'`, applicable: []string{"object"}},
+		{fn: `findIndex @ == 1`, applicable: []string{"array"}},
+		{fn: `toBool`, applicable: []string{"number", "string", "boolean"}},
+		{fn: `min`, applicable: []string{"array"}},
+		{fn: `max`, applicable: []string{"array"}},
+		{fn: `paths`, applicable: []string{"object", "array"}},
+		{fn: `dedupeAdjacent`, applicable: []string{"array"}},
+		{fn: `not`, applicable: []string{"boolean"}},
+		{fn: `typeIs 'null'`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `head`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `toArray`, applicable: []string{"null", "number", "string", "boolean", "object", "array"}},
+		{fn: `year`, applicable: []string{"string"}},
+		{fn: `month`, applicable: []string{"string"}},
+		{fn: `day`, applicable: []string{"string"}},
+		{fn: `dateFormat '2006'`, applicable: []string{"string"}},
+		{fn: `dateAdd '1h'`, applicable: []string{"string"}},
+	}
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	for _, tt := range tests {
+		for _, typ := range []string{"null", "number", "string", "boolean", "object", "array"} {
+			name := tt.fn + " " + typ
+			t.Run(name, func(t *testing.T) {
+				path, err := jsonpath.Compile(`$.` + typ + `.(` + tt.fn + `)`)
+				if err != nil {
+					t.Errorf("%v: Compile: error = %v", name, err)
+					return
+				}
+
+				applicable := false
+				for _, x := range tt.applicable {
+					if x == typ {
+						applicable = true
+					}
+				}
+
+				_, err = path.Query(json)
+				if errors.Is(err, jsonpath.ErrFunctionNotApplicable) == applicable {
+					t.Errorf("%v: applicable = %v, error = %v", name, applicable, err)
+					return
+				}
+			})
+		}
+	}
+}
+
+func TestPercentileRanks(t *testing.T) {
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i + 1)
+	}
+	json, err := jsonpath.ReadString(`[` + strings.Join(items, ",") + `]`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	// On 1..100, the nearest rank of p is p itself.
+	for p := 1; p <= 100; p++ {
+		v, err := jsonpath.QueryString(json, `$.(percentile `+strconv.Itoa(p)+`)`)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", p, err)
+			return
+		}
+		if v != float64(p) {
+			t.Errorf("%v: v = %v, want = %v", p, v, p)
+		}
+	}
+}
+
+func TestChunkHugeSize(t *testing.T) {
+	doc := make([]interface{}, 2001)
+	for i := range doc {
+		doc[i] = float64(i)
+	}
+
+	json, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	// NOTE: The largest integer below 2^63 that float64 represents exactly.
+	path, err := jsonpath.Compile(`$.(chunk 9223372036854774784)`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	v, err := path.Query(json)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+	if want := []interface{}{doc}; !reflect.DeepEqual(v, want) {
+		t.Errorf("v = %v, want = %v", v, want)
+	}
+}
+
+func TestPageHugeLimit(t *testing.T) {
+	doc := make([]interface{}, 2001)
+	for i := range doc {
+		doc[i] = float64(i)
+	}
+
+	json, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	path, err := jsonpath.Compile(`$.(page 1500 9223372036854774784)`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	v, err := path.Query(json)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+	if want := doc[1500:]; !reflect.DeepEqual(v, want) {
+		t.Errorf("len(v) = %v, want = %v", len(v.([]interface{})), len(want))
+	}
+}
+
+func TestFlattenDeepDeeplyNested(t *testing.T) {
+	const depth = 100000
+
+	var doc interface{} = []interface{}{float64(depth)}
+	for i := depth - 1; i >= 0; i-- {
+		doc = []interface{}{float64(i), doc}
+	}
+
+	json, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	path, err := jsonpath.Compile(`$.(flattenDeep)`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	// NOTE: A naive recursive implementation overflows this stack limit.
+	prev := debug.SetMaxStack(1 << 20)
+	defer debug.SetMaxStack(prev)
+
+	v, err := path.Query(json)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+
+	z := v.([]interface{})
+	if len(z) != depth+1 {
+		t.Errorf("len(v) = %v, want = %v", len(z), depth+1)
+		return
+	}
+	for i, w := range z {
+		if w != float64(i) {
+			t.Errorf("v[%v] = %v, want = %v", i, w, i)
+			return
+		}
+	}
+}
+
+func TestDepthOfDeeplyNested(t *testing.T) {
+	const depth = 100000
+
+	var doc interface{} = "leaf"
+	for i := 0; i < depth; i++ {
+		doc = map[string]interface{}{"a": []interface{}{doc}}
+	}
+
+	json, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	path, err := jsonpath.Compile(`$.(depthOf)`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+
+	// NOTE: A naive recursive implementation overflows this stack limit.
+	prev := debug.SetMaxStack(1 << 20)
+	defer debug.SetMaxStack(prev)
+
+	v, err := path.Query(json)
+	if err != nil {
+		t.Errorf("Query: error = %v", err)
+		return
+	}
+	if v != float64(depth*2) {
+		t.Errorf("v = %v, want = %v", v, depth*2)
+	}
+}
+
+func TestToJSONString(t *testing.T) {
+	const src = `{"config":{"b":[1,2.5,"x<y"],"a":{"n":null,"t":true}},"s":"q\"uote","n":-0.5}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	for _, p := range []string{`$`, `$.config`, `$.config.b`, `$.config.a.n`, `$.config.a.t`, `$.s`, `$.n`} {
+		path, err := jsonpath.Compile(p)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", p, err)
+			return
+		}
+		want, err := path.Query(json)
+		if err != nil {
+			t.Errorf("%v: Query: error = %v", p, err)
+			return
+		}
+
+		v, err := jsonpath.QueryString(json, p+`.(toJSONString)`)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", p, err)
+			return
+		}
+		s, ok := v.(string)
+		if !ok {
+			t.Errorf("%v: v = %v, want string", p, v)
+			return
+		}
+
+		json2, err := jsonpath.ReadString(s)
+		if err != nil {
+			t.Errorf("%v: ReadString: error = %v", p, err)
+			return
+		}
+		got, err := jsonpath.QueryString(json2, `$`)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", p, err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got = %v, want = %v", p, got, want)
+		}
+	}
+
+	v, _ := jsonpath.QueryString(json, `$.config.a.(toJSONString)`)
+	if v != `{"n":null,"t":true}` {
+		t.Errorf("v = %v, want compact JSON", v)
+	}
+}
+
+func TestMergeDeepDoesNotModifySources(t *testing.T) {
+	const src = `{"base":{"b":{"y":{"p":1}}},"patch":{"b":{"y":{"q":2}}}}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+	if _, err := jsonpath.QueryString(json, `$.(mergeDeep '$.base' '$.patch')`); err != nil {
+		t.Errorf("QueryString: error = %v", err)
+		return
+	}
+
+	orig, _ := jsonpath.ReadString(src)
+	if !reflect.DeepEqual(json.Root(), orig.Root()) {
+		t.Errorf("sources are modified: %v", json.Root())
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	err := jsonpath.RegisterFunction("test:repeat", func(v interface{}, args []interface{}) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("not a string")
+		}
+		n := 2
+		if len(args) > 0 {
+			f, ok := args[0].(float64)
+			if !ok {
+				return nil, errors.New("bad count")
+			}
+			n = int(f)
+		}
+		ret := ""
+		for i := 0; i < n; i++ {
+			ret += s
+		}
+		return ret, nil
+	})
+	if err != nil {
+		t.Errorf("RegisterFunction: error = %v", err)
+		return
+	}
+	err = jsonpath.RegisterFunction("test:bad", func(v interface{}, args []interface{}) (interface{}, error) {
+		return struct{}{}, nil
+	})
+	if err != nil {
+		t.Errorf("RegisterFunction: error = %v", err)
+		return
+	}
+
+	for _, name := range []string{"test:repeat", "length", "test:", ":length", "a:b:c", "te st:x"} {
+		if err := jsonpath.RegisterFunction(name, func(v interface{}, args []interface{}) (interface{}, error) {
+			return v, nil
+		}); err == nil {
+			t.Errorf("RegisterFunction(%v): want error", name)
+		}
+	}
+	if err := jsonpath.RegisterFunction("test:nil", nil); err == nil {
+		t.Errorf("RegisterFunction: want error")
+	}
+
+	json, err := jsonpath.ReadString(`{"x":"ab","n":1}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.x.(test:repeat)`,
+		want:    "abab",
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.x.(test:repeat 3).(trimPrefix 'ab')`,
+		want:    "abab",
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.n.(test:repeat)`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "4",
+		path:    `$.x.(test:repeat 'a')`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "5",
+		path:    `$.x.(test:bad)`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			if s := path.String(); s != tt.path {
+				t.Errorf("%v: String = %v, want = %v", tt.name, s, tt.path)
+			}
+			v, err := path.Query(json)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("%v: Query: error = %v", tt.name, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+		})
+	}
+
+	for _, p := range []string{`$.x.(other:repeat)`, `$.x.(test:)`, `$.x.(test:repeat ?(@ == 1))`} {
+		if _, err := jsonpath.Compile(p); err == nil {
+			t.Errorf("%v: Compile: want error", p)
+		}
+	}
+}
+
+func TestEntriesRoundTrip(t *testing.T) {
+	for _, src := range []string{`{}`, `{"a":1}`, `{"z":[1,{"y":null}],"a":"x","m":{"k":true}}`} {
+		json, err := jsonpath.ReadString(src)
+		if err != nil {
+			t.Errorf("%v: ReadString: error = %v", src, err)
+			return
+		}
+		got, err := jsonpath.QueryString(json, `$.(toEntries).(fromEntries)`)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", src, err)
+			return
+		}
+		if !jsonpath.Equal(got, json.Root()) {
+			t.Errorf("%v: got = %v", src, got)
+		}
+	}
+}
+
+func TestEqualsJSONNumber(t *testing.T) {
+	doc := map[string]interface{}{
+		"n": json.Number("1"),
+		"o": map[string]interface{}{"a": json.Number("1.50"), "b": []interface{}{json.Number("2")}},
+	}
+	pjson, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{path: `$.n.(equals '1')`, want: true},
+		{path: `$.n.(equals '1.0')`, want: true},
+		{path: `$.n.(equals '"1"')`, want: false},
+		{path: `$.o.(equals '{"b":[2],"a":1.5}')`, want: true},
+		{path: `$.o.(equals '{"b":[2],"a":1}')`, want: false},
+		{path: `$.n.(in 1)`, want: true},
+		{path: `$[?(@ == 1)]`, want: []interface{}{json.Number("1")}},
+	}
+	for _, tt := range tests {
+		v, err := jsonpath.QueryString(pjson, tt.path)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("%v: v = %v, want = %v", tt.path, v, tt.want)
+		}
+	}
+}
+
+func TestHashKeyOrder(t *testing.T) {
+	const src = `{"config":{"a":1,"b":{"x":[1,{"p":true,"q":null}],"y":"s"}}}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+	want, err := jsonpath.QueryString(json, `$.config.(hash)`)
+	if err != nil {
+		t.Errorf("QueryString: error = %v", err)
+		return
+	}
+
+	// The key order does not affect the hash.
+	for _, s := range []string{
+		`{"config":{"b":{"y":"s","x":[1,{"q":null,"p":true}]},"a":1.0}}`,
+		`{"other":0,"config":{"a":1,"b":{"y":"s","x":[1,{"q":null,"p":true}]}}}`,
+	} {
+		json2, err := jsonpath.ReadString(s)
+		if err != nil {
+			t.Errorf("%v: ReadString: error = %v", s, err)
+			return
+		}
+		if got, _ := jsonpath.QueryString(json2, `$.config.(hash)`); got != want {
+			t.Errorf("%v: got = %v, want = %v", s, got, want)
+		}
+
+		json3, err := jsonpath.ReadOrdered(s)
+		if err != nil {
+			t.Errorf("%v: ReadOrdered: error = %v", s, err)
+			return
+		}
+		if got, _ := jsonpath.QueryString(json3, `$.config.(hash)`); got != want {
+			t.Errorf("%v: ReadOrdered: got = %v, want = %v", s, got, want)
+		}
+	}
+
+	// The array order and the values do.
+	for _, s := range []string{
+		`{"config":{"a":1,"b":{"x":[{"p":true,"q":null},1],"y":"s"}}}`,
+		`{"config":{"a":2,"b":{"x":[1,{"p":true,"q":null}],"y":"s"}}}`,
+		`{"config":{"a":1,"b":{"x":[1,{"p":true,"q":null}],"y":"s","z":null}}}`,
+	} {
+		json2, err := jsonpath.ReadString(s)
+		if err != nil {
+			t.Errorf("%v: ReadString: error = %v", s, err)
+			return
+		}
+		if got, _ := jsonpath.QueryString(json2, `$.config.(hash)`); got == want {
+			t.Errorf("%v: got = %v, want different hash", s, got)
+		}
+	}
+
+}
+
+func TestHashJSONNumber(t *testing.T) {
+	plain, err := jsonpath.ReadString(`{"a":1,"b":[1,{"p":true,"q":null}]}`)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+	want, err := jsonpath.QueryString(plain, `$.(hash)`)
+	if err != nil {
+		t.Errorf("QueryString: error = %v", err)
+		return
+	}
+
+	// The numbers are hashed by their values.
+	doc := map[string]interface{}{
+		"a": json.Number("1.0"),
+		"b": []interface{}{json.Number("1"), map[string]interface{}{"p": true, "q": nil}},
+	}
+	pjson, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+	if got, err := jsonpath.QueryString(pjson, `$.(hash)`); err != nil || got != want {
+		t.Errorf("got = %v, %v, want = %v", got, err, want)
+	}
+}
@@ -1,9 +1,13 @@
 package jsonpath
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -15,12 +19,21 @@ const (
 	astType_NameIndexer astType = iota + 1
 	astType_NumberIndexer
 	astType_Function
+	astType_RecursiveDescent
+	astType_Filter
+	astType_Wildcard
+	astType_Union
+	astType_Slice
 )
 
 type ast struct {
-	typ   astType
-	name  string
-	index int
+	typ    astType
+	name   string
+	index  int
+	args   []interface{}       // function arguments, union members (string or int), or slice bounds (int or nil)
+	paths  []*CompiledJSONPath // compiled path arguments (parallel to args)
+	values []interface{}       // decoded JSON arguments (parallel to args)
+	filter *filterExpr
 }
 
 type JSONValueType int
@@ -36,12 +49,45 @@ const (
 )
 
 type parsedJSON struct {
-	typ   JSONValueType
-	value interface{}
+	typ     JSONValueType
+	value   interface{}
+	raw     []byte
+	rawRoot *rawNode
+	ordered bool // read by ReadOrdered
 }
 
 type CompiledJSONPath struct {
-	asts []ast
+	asts     []ast
+	multi    bool
+	relative bool
+	opts     CompileOptions
+	fast     fastAccessor
+}
+
+// Accessor of the path that consists of the name and number indexers only.
+// It returns false on any failure, then the generic interpreter is used to get the error.
+type fastAccessor func(v interface{}) (interface{}, bool)
+
+// ErrNullIntermediate is returned (wrapped) when the path navigates into an explicit null
+// (e.g. `$.a.b` and `a` is null). The error message has the path to the null value.
+var ErrNullIntermediate = errors.New("Intermediate value is null")
+
+// PathError is the error returned when the path cannot be compiled.
+// Pos is the offset of the offending character in runes.
+type PathError struct {
+	Pos int
+	Msg string
+}
+
+func (e *PathError) Error() string {
+	return e.Msg
+}
+
+func newPathError(pos int, format string, a ...interface{}) *PathError {
+	return &PathError{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, a...),
+	}
 }
 
 func newParsedJSON() *parsedJSON {
@@ -75,22 +121,227 @@ func FromAny(v interface{}) (*parsedJSON, error) {
 	return p, nil
 }
 
+// ReadValue reads the decoded data (e.g. decoded by a YAML library).
+// Unlike FromAny, it converts the values recursively into the JSON shapes:
+//   - maps (e.g. map[interface{}]interface{}, map[string]string) to map[string]interface{}
+//   - slices and arrays (e.g. []string) to []interface{}
+//   - integers, float32 and json.Number to float64
+//
+// Non-string map keys are stringified; numbers in the decimal form, booleans as `true`/`false` and nil as `null`.
+func ReadValue(v interface{}) (*parsedJSON, error) {
+	return ReadValueWithOptions(v, ReadOptions{})
+}
+
+// ReadValueWithOptions reads the decoded data like ReadValue.
+// If opts.InternKeys is set, the object keys are interned through it.
+func ReadValueWithOptions(v interface{}, opts ReadOptions) (*parsedJSON, error) {
+	w, err := normalizeValue(v, opts.InternKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newParsedJSON()
+	p.typ = ClassifyValue(w)
+	p.value = w
+	return p, nil
+}
+
+func internKey(intern map[string]string, k string) string {
+	if intern == nil {
+		return k
+	}
+	if s, ok := intern[k]; ok {
+		return s
+	}
+	intern[k] = k
+	return k
+}
+
+func normalizeValue(v interface{}, intern map[string]string) (interface{}, error) {
+	switch z := v.(type) {
+	case nil, bool, string, float64:
+		return z, nil
+	case float32:
+		return float64(z), nil
+	case json.Number:
+		f, err := z.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("ReadValue: Bad number: %v", z)
+		}
+		return f, nil
+	case int:
+		return float64(z), nil
+	case int8:
+		return float64(z), nil
+	case int16:
+		return float64(z), nil
+	case int32:
+		return float64(z), nil
+	case int64:
+		return float64(z), nil
+	case uint:
+		return float64(z), nil
+	case uint8:
+		return float64(z), nil
+	case uint16:
+		return float64(z), nil
+	case uint32:
+		return float64(z), nil
+	case uint64:
+		return float64(z), nil
+	case []interface{}:
+		ret := make([]interface{}, len(z))
+		for i, x := range z {
+			w, err := normalizeValue(x, intern)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = w
+		}
+		return ret, nil
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(z))
+		for k, x := range z {
+			w, err := normalizeValue(x, intern)
+			if err != nil {
+				return nil, err
+			}
+			ret[internKey(intern, k)] = w
+		}
+		return ret, nil
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(z))
+		for k, x := range z {
+			key, err := normalizeKey(k)
+			if err != nil {
+				return nil, err
+			}
+			w, err := normalizeValue(x, intern)
+			if err != nil {
+				return nil, err
+			}
+			ret[internKey(intern, key)] = w
+		}
+		return ret, nil
+	}
+	return normalizeReflectValue(v, intern)
+}
+
+// Converts the typed slices, arrays and maps (e.g. []string, map[string]int) by reflection.
+func normalizeReflectValue(v interface{}, intern map[string]string) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		ret := make([]interface{}, rv.Len())
+		for i := range ret {
+			w, err := normalizeValue(rv.Index(i).Interface(), intern)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = w
+		}
+		return ret, nil
+	case reflect.Map:
+		ret := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			var key string
+			if k := iter.Key(); k.Kind() == reflect.String {
+				key = k.String()
+			} else {
+				var err error
+				key, err = normalizeKey(k.Interface())
+				if err != nil {
+					return nil, err
+				}
+			}
+			w, err := normalizeValue(iter.Value().Interface(), intern)
+			if err != nil {
+				return nil, err
+			}
+			ret[internKey(intern, key)] = w
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("ReadValue: Unknown type: %T", v)
+}
+
+func normalizeKey(k interface{}) (string, error) {
+	switch z := k.(type) {
+	case string:
+		return z, nil
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(z), nil
+	}
+
+	w, err := normalizeValue(k, nil)
+	if err != nil {
+		return "", err
+	}
+	if f, ok := w.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("ReadValue: Unsupported key type: %T", k)
+}
+
 func ReadString(src string) (*parsedJSON, error) {
+	return ReadStringWithOptions(src, ReadOptions{})
+}
+
+// ReadStringWithLimit reads the JSON like ReadString.
+// It is an error if the source is longer than maxBytes (checked before decoding).
+func ReadStringWithLimit(src string, maxBytes int) (*parsedJSON, error) {
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("ReadString: Bad size limit: Limit=%v", maxBytes)
+	}
+	if len(src) > maxBytes {
+		return nil, fmt.Errorf("ReadString: Source exceeds the size limit: Limit=%v, Size=%v", maxBytes, len(src))
+	}
+	return ReadString(src)
+}
+
+// ReadReaderWithLimit reads the JSON from the reader.
+// It is an error if the reader has more than maxBytes bytes; it stops reading at the limit.
+func ReadReaderWithLimit(r io.Reader, maxBytes int) (*parsedJSON, error) {
+	if maxBytes < 0 {
+		return nil, fmt.Errorf("ReadReader: Bad size limit: Limit=%v", maxBytes)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, int64(maxBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxBytes {
+		return nil, fmt.Errorf("ReadReader: Source exceeds the size limit: Limit=%v", maxBytes)
+	}
+	return ReadString(string(b))
+}
+
+func ReadStringWithOptions(src string, opts ReadOptions) (*parsedJSON, error) {
 	p := newParsedJSON()
 	var err error
 
-	src2 := strings.TrimSpace(src)
-	if src == "" {
+	// NOTE: Sniffs the type by the first non-space byte without making a trimmed copy.
+	start := skipJSONSpaces(src, 0)
+	if start == len(src) {
 		return nil, errors.New("ReadString: Source is empty")
 	}
 
+	if opts.AllowLeadingPlus && start+1 < len(src) && src[start] == '+' && '0' <= src[start+1] && src[start+1] <= '9' {
+		start++
+	}
+	src2 := src[start:]
+
 	p.value = nil
 
 	// NOTE: NaN and Infinity are not valid JSON
-	switch src[0] {
+	switch src2[0] {
 	case 'n':
-		if src != "null" {
-			return nil, fmt.Errorf("ReadString: Unrecognised tokens appeared: Pos=%v, %v", 0, string(src[0:]))
+		if strings.TrimRight(src2, " \t\r\n") != "null" {
+			return nil, fmt.Errorf("ReadString: Unrecognised tokens appeared: Pos=%v, %v", start, src2)
 		}
 		p.typ = Type_Null
 	case '{':
@@ -120,228 +371,1292 @@ func ReadString(src string) (*parsedJSON, error) {
 		p.value = dst
 	}
 
-	if err != nil {
-		return nil, err
-	} else {
-		return p, nil
+	if err != nil {
+		return nil, err
+	} else {
+		return p, nil
+	}
+}
+
+// Returns the index of the first non-space byte (JSON spaces only).
+func skipJSONSpaces(src string, start int) int {
+	for i := start; i < len(src); i++ {
+		switch src[i] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return i
+	}
+	return len(src)
+}
+
+func (p parsedJSON) Root() interface{} {
+	return p.value
+}
+
+func Compile(path string) (*CompiledJSONPath, error) {
+	return compileCore([]rune(path), '$', CompileOptions{})
+}
+
+// CompileBytes compiles the UTF-8 encoded path like Compile without converting it to a string.
+func CompileBytes(path []byte) (*CompiledJSONPath, error) {
+	return compileCore(bytes.Runes(path), '$', CompileOptions{})
+}
+
+// CompilePrefix compiles the path at the start of src and returns the number of runes consumed.
+// It stops at the first character that cannot start a path segment
+// (e.g. `$.foo.bar + 1` consumes `$.foo.bar`), so that the outer parser can continue.
+// A segment that is started but malformed (e.g. `$.foo[1`) is still an error.
+func CompilePrefix(src string) (*CompiledJSONPath, int, error) {
+	return compileCoreWithEnd([]rune(src), '$', true, CompileOptions{})
+}
+
+// CompileWithOptions compiles the path like Compile with the options.
+// The options also apply to the paths in the filters.
+// NOTE: The options are not a part of the text form (String, MarshalText).
+func CompileWithOptions(path string, opts CompileOptions) (*CompiledJSONPath, error) {
+	p, err := compileCore([]rune(path), '$', opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DisableWildcards {
+		if err := checkNoWildcards(p); err != nil {
+			return nil, err
+		}
+	}
+	p.opts = opts
+	return p, nil
+}
+
+// Rejects the multi-valued segments except the filters,
+// including the ones in the paths of the filters and the function arguments.
+func checkNoWildcards(p *CompiledJSONPath) error {
+	for i := range p.asts {
+		a := &p.asts[i]
+		switch a.typ {
+		case astType_RecursiveDescent, astType_Wildcard, astType_Union, astType_Slice:
+			seg := &CompiledJSONPath{asts: p.asts[i : i+1], relative: p.relative}
+			return fmt.Errorf("CompileWithOptions: Wildcards are disabled: Level=%v, %v", i, seg.String())
+		}
+		if a.filter != nil {
+			if err := a.filter.walkPaths(checkNoWildcards); err != nil {
+				return err
+			}
+		}
+		for _, q := range a.paths {
+			if err := checkNoWildcards(q); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compileCore(src []rune, root rune, opts CompileOptions) (*CompiledJSONPath, error) {
+	p, _, err := compileCoreWithEnd(src, root, false, opts)
+	return p, err
+}
+
+// If prefix is true, it stops at the first character that cannot start a segment
+// and returns the length of the path (trailing spaces are not included).
+func compileCoreWithEnd(src []rune, root rune, prefix bool, opts CompileOptions) (*CompiledJSONPath, int, error) {
+	if len(src) == 0 {
+		return nil, 0, newPathError(0, "compileCore: Path is empty: Pos=%v", 0)
+	}
+	if src[0] != root {
+		return nil, 0, newPathError(0, "compileCore: Path should be starts with '%v': Pos=%v, %v", string(root), 0, string(src[0]))
+	}
+
+	length := len(src)
+	asts := make([]ast, 0, 20)
+	var start, end int
+	var err error
+	var name string
+	last := 1
+
+loop:
+	for i := 1; i < length; i++ {
+		ch := src[i]
+
+		if unicode.IsSpace(ch) || unicode.IsControl(ch) {
+			end, err = skipSpaces(src, i+1)
+			if err != nil {
+				return nil, 0, newPathError(i, "compileCore: Unexpected termination: Pos=%v, %v", i, string(src[i:]))
+			}
+			i = end - 1
+
+		} else {
+			switch ch {
+			case '[':
+				// number indexer / name indexer
+				end, err = skipSpaces(src, i+1)
+				if err != nil || end == length {
+					return nil, 0, newPathError(i, "compileCore: Unexpected termination in the '[' bracket: Pos=%v", i)
+				}
+				start = end
+
+				// TODO: %#name : number indexer variable
+				// TODO: %name  : name indexer variable
+
+				if '0' <= src[start] && src[start] <= '9' || src[start] == '-' || src[start] == ':' {
+					var lower interface{}
+					end = start
+					if src[start] != ':' {
+						var num int
+						num, end, err = parseIndex(src, start)
+						if err != nil {
+							return nil, 0, err
+						}
+						lower = num
+					}
+
+					if sep, _ := skipSpaces(src, end); sep < length && src[sep] == ':' {
+						// slice
+						var upper interface{}
+						end, _ = skipSpaces(src, sep+1)
+						if end < length && ('0' <= src[end] && src[end] <= '9' || src[end] == '-') {
+							var num int
+							num, end, err = parseIndex(src, end)
+							if err != nil {
+								return nil, 0, err
+							}
+							upper = num
+						}
+						asts = append(asts, ast{
+							typ:  astType_Slice,
+							args: []interface{}{lower, upper},
+						})
+					} else {
+						asts = append(asts, ast{
+							typ:   astType_NumberIndexer,
+							index: lower.(int),
+						})
+					}
+				} else {
+					ch2 := src[start]
+
+					switch ch2 {
+					case '?':
+						// filter
+						end, err = skipSpaces(src, start+1)
+						if err != nil || end == length || src[end] != '(' {
+							return nil, 0, newPathError(end, "compileCore: '(' is expected after '?': Pos=%v, %v", end, string(src[end:]))
+						}
+						pos := end
+
+						var filter *filterExpr
+						filter, end, err = parseFilterExpr(src, end+1, opts)
+						if err != nil {
+							return nil, 0, err
+						}
+						if end == length {
+							return nil, 0, newPathError(end, "compileCore: Unexpected termination in the '(' parenthesis: Pos=%v", end)
+						}
+						if src[end] != ')' {
+							return nil, 0, newPathError(pos, "compileCore: '(' parenthesis is not closed: Pos=%v, %v", pos, string(src[pos:]))
+						}
+						end++
+
+						asts = append(asts, ast{
+							typ:    astType_Filter,
+							filter: filter,
+						})
+					case '*':
+						// wildcard
+						end = start + 1
+						asts = append(asts, ast{
+							typ: astType_Wildcard,
+						})
+					case '\'', '"':
+						// quoted name
+						name, end, err = parseQuotedName(src, ch2, start+1, opts)
+						if err != nil {
+							return nil, 0, newPathError(start, "compileCore: Bad quoted name expression: Pos=%v, %v", start, string(src[start:]))
+						}
+						asts = append(asts, ast{
+							typ:  astType_NameIndexer,
+							name: name,
+						})
+					default:
+						return nil, 0, newPathError(start, "compileCore: Bad quoted name expression: Pos=%v, %v", start, string(src[start:]))
+					}
+				}
+
+				end, err = skipSpaces(src, end)
+				if err != nil || end == length {
+					return nil, 0, newPathError(end, "compileCore: Unexpected termination in the '[' bracket: Pos=%v", end)
+				}
+
+				if src[end] == ',' {
+					// union
+					end, err = parseUnion(src, end, &asts[len(asts)-1], opts)
+					if err != nil {
+						return nil, 0, err
+					}
+				}
+
+				if src[end] != ']' {
+					return nil, 0, newPathError(end, "compileCore: '[' bracket is not closed: Pos=%v, %v", end, string(src[end:]))
+				}
+				i = end // end is ']'
+				last = end + 1
+
+			case '.':
+				if i+1 < length && src[i+1] == '.' {
+					// recursive descent
+					asts = append(asts, ast{
+						typ: astType_RecursiveDescent,
+					})
+					i++
+
+					end, err = skipSpaces(src, i+1)
+					if err == nil && end < length && src[end] == '[' {
+						i = end - 1
+						continue
+					}
+				}
+
+				end, err = skipSpaces(src, i+1)
+				if err != nil || end == length {
+					return nil, 0, newPathError(i, "compileCore: Unexpected termination after '.': Pos=%v", i)
+				}
+				start = end
+				ch2 := src[start]
+
+				switch ch2 {
+				case '(':
+					// function
+					var a ast
+					a, end, err = parseFunctionCall(src, start, opts)
+					if err != nil {
+						return nil, 0, err
+					}
+					asts = append(asts, a)
+					i = end // end is ')'
+					last = end + 1
+
+				case '*':
+					// wildcard
+					asts = append(asts, ast{
+						typ: astType_Wildcard,
+					})
+					last = start + 1
+
+					end, err = skipSpaces(src, start+1)
+					if err != nil {
+						return nil, 0, newPathError(start, "compileCore: Bad wildcard expression: Pos=%v, %v", start, string(src[start:]))
+					}
+					i = end - 1
+
+				default:
+					// bare name
+					if !isBareNameRuneWithOptions(ch2, opts) {
+						// e.g. `$.a...b`, `$.a.[0]`
+						return nil, 0, newPathError(start, "compileCore: Empty name after '.': Pos=%v, %v", start, string(src[start:]))
+					}
+					name, end, err = parseBareName(src, start, opts)
+					if err != nil {
+						return nil, 0, newPathError(start, "compileCore: Bad name expression: Pos=%v, %v", start, string(src[start:]))
+					}
+					asts = append(asts, ast{
+						typ:  astType_NameIndexer,
+						name: name,
+					})
+					last = end
+
+					end, err = skipSpaces(src, end)
+					if err != nil {
+						return nil, 0, newPathError(start, "compileCore: Bad name expression: Pos=%v, %v", start, string(src[start:]))
+					}
+					i = end - 1
+				}
+
+			case '(':
+				// chained function (e.g. `$.a.(reverse)(first)`, `$.a.(reverse) (first)`)
+				prev := i - 1
+				for prev > 0 && (unicode.IsSpace(src[prev]) || unicode.IsControl(src[prev])) {
+					prev--
+				}
+				if src[prev] != ')' || len(asts) == 0 || asts[len(asts)-1].typ != astType_Function {
+					if prefix {
+						break loop
+					}
+					return nil, 0, newPathError(i, "compileCore: Unexpected character appeared: Pos=%v, %v", i, string(src[i:]))
+				}
+				var a ast
+				a, end, err = parseFunctionCall(src, i, opts)
+				if err != nil {
+					return nil, 0, err
+				}
+				asts = append(asts, a)
+				i = end // end is ')'
+				last = end + 1
+
+			default:
+				if prefix {
+					break loop
+				}
+				return nil, 0, newPathError(i, "compileCore: Unexpected character appeared: Pos=%v, %v", i, string(src[i:]))
+			}
+		}
+	}
+
+	return &CompiledJSONPath{
+		asts:     asts,
+		multi:    isMultiValued(asts),
+		relative: root == '@',
+		fast:     newFastAccessor(asts),
+	}, last, nil
+}
+
+// Parses the function call (e.g. `(take 2)`) starting at '('.
+// Returns the position of the closing ')'.
+func parseFunctionCall(src []rune, start int, opts CompileOptions) (ast, int, error) {
+	length := len(src)
+
+	end, err := skipSpaces(src, start+1)
+	if err != nil {
+		return ast{}, 0, newPathError(start, "compileCore: Unexpected termination in the '(' parenthesis: Pos=%v", start)
+	}
+	start = end
+
+	name, end, err := parseBareName(src, start, CompileOptions{})
+	if err != nil {
+		return ast{}, 0, newPathError(start, "compileCore: Bad function name expression: Pos=%v, %v", start, string(src[start:]))
+	}
+	if end < length && src[end] == ':' {
+		// namespaced custom function name
+		var local string
+		local, end, err = parseBareName(src, end+1, CompileOptions{})
+		if err != nil {
+			return ast{}, 0, newPathError(start, "compileCore: Bad function name expression: Pos=%v, %v", start, string(src[start:]))
+		}
+		name = name + ":" + local
+	}
+	a := ast{
+		typ:  astType_Function,
+		name: string(name),
+	}
+
+	end, err = parseFunctionParams(src, end, &a, opts)
+	if err != nil {
+		return ast{}, 0, err
+	}
+	if end == length {
+		return ast{}, 0, newPathError(end, "compileCore: Unexpected termination in the '(' parenthesis: Pos=%v", end)
+	}
+
+	if src[end] != ')' {
+		return ast{}, 0, newPathError(end, "compileCore: '(' parenthesis is not closed: Pos=%v, %v", end, string(src[end:]))
+	}
+
+	if err = checkFunction(&a); err != nil {
+		return ast{}, 0, newPathError(start, "compileCore: %v: Pos=%v, %v", err, start, a.name)
+	}
+	return a, end, nil
+}
+
+// Parses the rest of the union (e.g. `,'b','c'` of `['a','b','c']`) and converts a into the union.
+// Members are all quoted names or all numbers.
+func parseUnion(src []rune, start int, a *ast, opts CompileOptions) (int, error) {
+	length := len(src)
+
+	var members []interface{}
+	if a.typ == astType_NameIndexer {
+		members = append(members, a.name)
+	} else if a.typ == astType_NumberIndexer {
+		members = append(members, a.index)
+	} else {
+		return start, newPathError(start, "compileCore: Union cannot be used here: Pos=%v, %v", start, string(src[start:]))
+	}
+
+	end := start
+	for end < length && src[end] == ',' {
+		i, _ := skipSpaces(src, end+1)
+		if i == length {
+			return start, newPathError(i, "compileCore: Unexpected termination in the union: Pos=%v", i)
+		}
+
+		var err error
+		switch ch := src[i]; {
+		case a.typ == astType_NameIndexer && (ch == '\'' || ch == '"'):
+			var name string
+			name, end, err = parseQuotedName(src, ch, i+1, opts)
+			if err != nil {
+				return start, newPathError(i, "compileCore: Bad quoted name expression: Pos=%v, %v", i, string(src[i:]))
+			}
+			members = append(members, name)
+		case a.typ == astType_NumberIndexer && ('0' <= ch && ch <= '9' || ch == '-'):
+			end, err = parseNumber(src, i)
+			if err != nil {
+				return start, newPathError(i, "compileCore: Bad number expression: Pos=%v, %v", i, string(src[i:]))
+			}
+			num, err := strconv.ParseInt(string(src[i:end]), 10, 64)
+			if err != nil {
+				return start, newPathError(i, "compileCore: Integer cannot be parsed: Pos=%v, %v", i, string(src[i:end]))
+			}
+			members = append(members, int(num))
+		default:
+			return start, newPathError(i, "compileCore: Union members should be all names or all numbers: Pos=%v, %v", i, string(src[i:]))
+		}
+
+		end, _ = skipSpaces(src, end)
+		if end == length {
+			return start, newPathError(end, "compileCore: Unexpected termination in the '[' bracket: Pos=%v", end)
+		}
+	}
+
+	*a = ast{
+		typ:  astType_Union,
+		args: members,
+	}
+	return end, nil
+}
+
+func isMultiValued(asts []ast) bool {
+	for i := range asts {
+		switch asts[i].typ {
+		case astType_RecursiveDescent, astType_Filter, astType_Wildcard:
+			return true
+		}
+	}
+	return false
+}
+
+// Returns nil if the path has the segments other than the name and number indexers.
+// NOTE: The results are identical to the generic interpreter, since the exact key match always wins
+// and the other cases (e.g. negative index, case-insensitive match) fall back to it.
+func newFastAccessor(asts []ast) fastAccessor {
+	if len(asts) == 0 {
+		return nil
+	}
+
+	type step struct {
+		name   string
+		index  int
+		byName bool
+	}
+
+	steps := make([]step, len(asts))
+	for i := range asts {
+		switch asts[i].typ {
+		case astType_NameIndexer:
+			steps[i] = step{name: asts[i].name, byName: true}
+		case astType_NumberIndexer:
+			if asts[i].index < 0 {
+				return nil
+			}
+			steps[i] = step{index: asts[i].index}
+		default:
+			return nil
+		}
+	}
+
+	if len(steps) == 1 && steps[0].byName {
+		name := steps[0].name
+		return func(v interface{}) (interface{}, bool) {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			w, ok := m[name]
+			return w, ok
+		}
+	}
+
+	return func(v interface{}) (interface{}, bool) {
+		for i := range steps {
+			s := &steps[i]
+			if s.byName {
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					return nil, false
+				}
+				if v, ok = m[s.name]; !ok {
+					return nil, false
+				}
+			} else {
+				z, ok := v.([]interface{})
+				if !ok || len(z) <= s.index {
+					return nil, false
+				}
+				v = z[s.index]
+			}
+		}
+		return v, true
+	}
+}
+
+// FormatPathError renders the error message followed by the path and
+// a caret '^' under the offending position, like compiler diagnostics.
+// If err is not a *PathError, only the error message is returned.
+func FormatPathError(path string, err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var pe *PathError
+	if !errors.As(err, &pe) {
+		return err.Error()
+	}
+
+	src := []rune(path)
+	pos := pe.Pos
+	if pos < 0 {
+		pos = 0
+	} else if pos > len(src) {
+		pos = len(src)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(pe.Msg)
+	sb.WriteString("\n")
+	sb.WriteString(path)
+	sb.WriteString("\n")
+	for _, ch := range src[:pos] {
+		// NOTE: Keep tabs so that the caret aligns with the path above.
+		if ch == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	sb.WriteRune('^')
+
+	return sb.String()
+}
+
+type queryContext struct {
+	root    interface{}
+	opts    CompileOptions
+	ordered bool
+}
+
+// Depth returns the number of the path segments (excluding the root).
+// All kinds of segments (names, indices, functions, recursive descents and filters) are counted as one.
+func (p *CompiledJSONPath) Depth() int {
+	return len(p.asts)
+}
+
+// Prefix returns a new path with the name segments prepended (e.g. `$.a` with "data" to `$.data.a`),
+// so that it queries the document wrapped in the objects (e.g. `{"data": ...}`).
+// The root-relative paths in the filters and the function arguments are also prefixed.
+// The path itself is not modified.
+func (p *CompiledJSONPath) Prefix(segments ...string) *CompiledJSONPath {
+	asts := make([]ast, 0, len(segments)+len(p.asts))
+	for _, s := range segments {
+		asts = append(asts, ast{typ: astType_NameIndexer, name: s})
+	}
+	for i := range p.asts {
+		asts = append(asts, p.asts[i].rebased(segments))
+	}
+
+	return &CompiledJSONPath{
+		asts:     asts,
+		multi:    p.multi,
+		relative: p.relative,
+		opts:     p.opts,
+		fast:     newFastAccessor(asts),
+	}
+}
+
+// Returns a copy of the path with the segments prepended if it is root-relative.
+// The root-relative paths nested in the relative path are also prefixed.
+func (p *CompiledJSONPath) rebased(segments []string) *CompiledJSONPath {
+	if !p.relative {
+		return p.Prefix(segments...)
+	}
+
+	asts := make([]ast, len(p.asts))
+	for i := range p.asts {
+		asts[i] = p.asts[i].rebased(segments)
+	}
+	return &CompiledJSONPath{
+		asts:     asts,
+		multi:    p.multi,
+		relative: p.relative,
+		opts:     p.opts,
+		fast:     newFastAccessor(asts),
+	}
+}
+
+// Returns a deep copy of the segment with the root-relative paths in it prefixed.
+// NOTE: The texts of the root-relative path arguments are also rewritten, so that String() is consistent.
+func (a *ast) rebased(segments []string) ast {
+	ret := *a
+	if a.args != nil {
+		ret.args = append([]interface{}(nil), a.args...)
+	}
+	if a.values != nil {
+		ret.values = append([]interface{}(nil), a.values...)
+	}
+	if a.paths != nil {
+		ret.paths = make([]*CompiledJSONPath, len(a.paths))
+		for i, q := range a.paths {
+			ret.paths[i] = q.rebased(segments)
+			if !q.relative {
+				ret.args[i] = ret.paths[i].String()
+			}
+		}
+	}
+	ret.filter = a.filter.rebased(segments)
+	return ret
+}
+
+// Query returns the value that the path points to.
+// If the path contains multi-valued segments (recursive descent, filter, wildcard),
+// it returns a []interface{} of all matches (it may be empty).
+func (p *CompiledJSONPath) Query(pjson *parsedJSON) (interface{}, error) {
+	if pjson.typ == Type_Invalid {
+		return nil, errors.New("Query: JSON is not read")
+	}
+
+	if p.fast != nil {
+		if w, ok := p.fast(pjson.value); ok {
+			return w, nil
+		}
+	}
+
+	c := &queryContext{
+		root:    pjson.value,
+		opts:    p.opts,
+		ordered: pjson.ordered,
+	}
+
+	if p.multi {
+		return p.queryAll(c, pjson.value)
+	}
+	return p.query(c, pjson.value)
+}
+
+// QueryTyped2 returns the value that the path points to, and its type.
+// Results of the multi-valued paths are Type_Array.
+func (p *CompiledJSONPath) QueryTyped2(pjson *parsedJSON) (interface{}, JSONValueType, error) {
+	v, err := p.Query(pjson)
+	if err != nil {
+		return nil, Type_Invalid, err
+	}
+	return v, ClassifyValue(v), nil
+}
+
+// ClassifyValue returns the JSON type of the value in the same way as the package does internally
+// (e.g. the type of the Query result). It returns Type_Invalid for the values that are not JSON shapes.
+func ClassifyValue(v interface{}) JSONValueType {
+	switch v.(type) {
+	case nil:
+		return Type_Null
+	case float64, int, json.Number:
+		return Type_Number
+	case string:
+		return Type_String
+	case bool:
+		return Type_Boolean
+	case map[string]interface{}, OrderedObject:
+		return Type_Object
+	case []interface{}:
+		return Type_Array
+	}
+	return Type_Invalid
+}
+
+func typeName(t JSONValueType) string {
+	switch t {
+	case Type_Null:
+		return "null"
+	case Type_Number:
+		return "number"
+	case Type_String:
+		return "string"
+	case Type_Boolean:
+		return "boolean"
+	case Type_Object:
+		return "object"
+	case Type_Array:
+		return "array"
+	}
+	return "unknown"
+}
+
+// Equal reports whether a and b are deeply equal as JSON values.
+// Numbers (including json.Number) are compared by their values (e.g. 1 and 1.0 are equal).
+// Arrays are compared in order, and objects are compared regardless of the key order.
+func Equal(a, b interface{}) bool {
+	if _, ok := a.(OrderedObject); ok {
+		a = plainValue(a)
+	}
+	if _, ok := b.(OrderedObject); ok {
+		b = plainValue(b)
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case nil, bool, string, float64, int, json.Number:
+		if !isScalar(b) {
+			return false
+		}
+		return scalarEqual(a, b)
+	}
+	return false
+}
+
+// QueryAll returns all the values that the path points to.
+// If the path is single-valued, it returns a slice of one value.
+// Object members are visited in the order of sorted keys.
+func (p *CompiledJSONPath) QueryAll(pjson *parsedJSON) ([]interface{}, error) {
+	if pjson.typ == Type_Invalid {
+		return nil, errors.New("QueryAll: JSON is not read")
+	}
+
+	c := &queryContext{
+		root:    pjson.value,
+		opts:    p.opts,
+		ordered: pjson.ordered,
+	}
+
+	if p.multi {
+		return p.queryAll(c, pjson.value)
+	}
+
+	v, err := p.query(c, pjson.value)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+// QueryAllDistinct returns the values like QueryAll, but with the duplicated scalars removed in the first-seen order.
+// Numbers are compared by their values. Objects and arrays are always kept.
+func (p *CompiledJSONPath) QueryAllDistinct(pjson *parsedJSON) ([]interface{}, error) {
+	if pjson.typ == Type_Invalid {
+		return nil, errors.New("QueryAllDistinct: JSON is not read")
+	}
+
+	vs, err := p.QueryAll(pjson)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]interface{}, 0, len(vs))
+	seen := make(map[interface{}]struct{})
+	for _, v := range vs {
+		if k, ok := scalarKey(v); ok {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// WalkMatches calls fn for each value that the path points to, without collecting the values into a slice.
+// The values are visited in the same order as QueryAll, but the items that the unions of indices and
+// the slices of arrays select are flattened, and fn is called for each of them
+// (e.g. twice for `$.a[0,1]`; `$..v[0,1]` yields `1, 2, 3` where QueryAll yields `[[1 2] [3]]`).
+// The union of names and the slice of a string yield one value (the partial object and the substring).
+// The single-valued path is queried as Query, and only the items of its last union or slice are flattened.
+// It stops and returns the error if fn returns an error.
+// Like QueryAll, the single-valued path is an error if the value does not exist.
+func (p *CompiledJSONPath) WalkMatches(pjson *parsedJSON, fn func(value interface{}) error) error {
+	if pjson.typ == Type_Invalid {
+		return errors.New("WalkMatches: JSON is not read")
+	}
+
+	c := &queryContext{
+		root:    pjson.value,
+		opts:    p.opts,
+		ordered: pjson.ordered,
+	}
+
+	if p.multi {
+		return p.walk(c, 0, pjson.value, fn)
+	}
+
+	v, err := p.query(c, pjson.value)
+	if err != nil {
+		return err
+	}
+	for _, w := range p.selectedItems(v) {
+		if err := fn(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NOTE: Visits the values depth-first, that yields the same order as queryAll.
+// The recursion is bounded by the number of segments.
+func (p *CompiledJSONPath) walk(c *queryContext, i int, v interface{}, fn func(value interface{}) error) error {
+	if i == len(p.asts) {
+		return fn(v)
+	}
+	a := &p.asts[i]
+
+	switch a.typ {
+	case astType_RecursiveDescent:
+		stack := []interface{}{v}
+		for len(stack) > 0 {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if err := p.walk(c, i+1, w, fn); err != nil {
+				return err
+			}
+
+			ch := children(w)
+			for j := len(ch) - 1; j >= 0; j-- {
+				stack = append(stack, ch[j])
+			}
+		}
+	case astType_Filter:
+		for _, w := range children(v) {
+			if a.filter.eval(c, w) {
+				if err := p.walk(c, i+1, w, fn); err != nil {
+					return err
+				}
+			}
+		}
+	case astType_Wildcard:
+		for _, w := range children(v) {
+			if err := p.walk(c, i+1, w, fn); err != nil {
+				return err
+			}
+		}
+	case astType_Union, astType_Slice:
+		for _, w := range p.selectItems(c, i, a, v) {
+			if err := p.walk(c, i+1, w, fn); err != nil {
+				return err
+			}
+		}
+	default:
+		w, err := p.step(c, i, a, v)
+		if err == nil {
+			return p.walk(c, i+1, w, fn)
+		}
 	}
+	return nil
 }
 
-func (p parsedJSON) Root() interface{} {
-	return p.value
+// Returns the items of the value of the single-valued path one by one, if the last segment is
+// the union of indices or the slice of an array (see WalkMatches). Otherwise the value itself is returned.
+func (p *CompiledJSONPath) selectedItems(v interface{}) []interface{} {
+	if n := len(p.asts); n > 0 {
+		switch p.asts[n-1].typ {
+		case astType_Union, astType_Slice:
+			if z, ok := v.([]interface{}); ok {
+				return z
+			}
+		}
+	}
+	return []interface{}{v}
 }
 
-func Compile(path string) (*CompiledJSONPath, error) {
-	return compileCore([]rune(path), '$')
+// Returns the items that the union or the slice selects from the array one by one.
+// The partial object of the union of names is returned as one value, and nothing is returned on failure.
+func (p *CompiledJSONPath) selectItems(c *queryContext, i int, a *ast, v interface{}) []interface{} {
+	w, err := p.step(c, i, a, v)
+	if err != nil {
+		return nil
+	}
+	if _, ok := v.([]interface{}); ok {
+		if z, ok := w.([]interface{}); ok {
+			return z
+		}
+	}
+	return []interface{}{w}
 }
 
-func compileCore(src []rune, root rune) (*CompiledJSONPath, error) {
-	if src[0] != root {
-		return nil, fmt.Errorf("compileCore: Path should be starts with '%v': Pos=%v, %v", string(root), 0, string(src[0]))
+func (p *CompiledJSONPath) query(c *queryContext, v interface{}) (interface{}, error) {
+	if p.fast != nil {
+		if w, ok := p.fast(v); ok {
+			return w, nil
+		}
 	}
 
-	length := len(src)
-	asts := make([]ast, 0, 20)
-	var start, end int
 	var err error
-	var name string
 
-	for i := 1; i < length; i++ {
-		ch := src[i]
+	for i := range p.asts {
+		v, err = p.step(c, i, &p.asts[i], v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
 
-		if unicode.IsSpace(ch) || unicode.IsControl(ch) {
-			end, err = skipSpaces(src, i+1)
-			if err != nil {
-				return nil, fmt.Errorf("compileCore: Unexpected termination: Pos=%v, %v", i, src[i:])
-			}
-			i = end - 1
+// NOTE: In the multi-valued query, the values that cannot be navigated
+// by the segment (missing property, index out of range, etc.) are skipped.
+// The filter tests every child including the scalars and the arrays;
+// the conditions on the missing keys (e.g. `@.type` of a scalar) are false, so they are skipped as well.
+func (p *CompiledJSONPath) queryAll(c *queryContext, v interface{}) ([]interface{}, error) {
+	nodes := []interface{}{v}
 
-		} else {
-			switch ch {
-			case '[':
-				// number indexer / name indexer
-				end, err = skipSpaces(src, i+1)
-				if err != nil || end == length {
-					return nil, fmt.Errorf("compileCore: Unexpected termination in the '[' bracket: Pos=%v", i)
+	for i := range p.asts {
+		a := &p.asts[i]
+		next := make([]interface{}, 0, len(nodes))
+
+		for _, v := range nodes {
+			switch a.typ {
+			case astType_RecursiveDescent:
+				next = appendDescendants(next, v)
+			case astType_Filter:
+				for _, w := range children(v) {
+					if a.filter.eval(c, w) {
+						next = append(next, w)
+					}
 				}
-				start = end
+			case astType_Wildcard:
+				next = append(next, children(v)...)
+			default:
+				w, err := p.step(c, i, a, v)
+				if err == nil {
+					next = append(next, w)
+				}
+			}
+		}
+		nodes = next
+	}
 
-				// TODO: %#name : number indexer variable
-				// TODO: %name  : name indexer variable
+	return nodes, nil
+}
 
-				if '0' <= src[start] && src[start] <= '9' || src[start] == '-' {
-					end, err = parseNumber(src, start)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Bad number expression: Pos=%v, %v", start, src[start:])
-					}
-					num, err := strconv.ParseInt(string(src[start:end]), 10, 64)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Integer cannot be parsed: Pos=%v, %v", start, src[start:end])
-					}
-					asts = append(asts, ast{
-						typ:   astType_NumberIndexer,
-						index: int(num),
-					})
-				} else {
-					ch2 := src[start]
+func (p *CompiledJSONPath) step(c *queryContext, i int, a *ast, v interface{}) (interface{}, error) {
+	if a.typ == astType_Function {
+		return callFunction(c, i, a, v)
+	}
 
-					switch ch2 {
-					case '\'', '"':
-						// quoted name
-						name, end, err = parseQuotedName(src, ch2, start+1)
-						if err != nil {
-							return nil, fmt.Errorf("compileCore: Bad quoted name expression: Pos=%v, %v", start, src[start:])
-						}
-						asts = append(asts, ast{
-							typ:  astType_NameIndexer,
-							name: name,
-						})
-					default:
-						return nil, fmt.Errorf("compileCore: Bad quoted name expression: Pos=%v, %v", start, src[start:])
-					}
+	if v == nil {
+		if i > 0 {
+			prefix := &CompiledJSONPath{asts: p.asts[:i], relative: p.relative}
+			return nil, fmt.Errorf("Query: %w: Level=%v, %v", ErrNullIntermediate, i, prefix.String())
+		}
+		return nil, fmt.Errorf("Query: Nil referenced: Level=%v", i)
+	}
+
+	switch z := v.(type) {
+	case map[string]interface{}:
+		switch a.typ {
+		case astType_NameIndexer:
+			w, ok := z[a.name]
+			if !ok && c.opts.CaseInsensitive {
+				return lookupKeyFold(z, a.name, i)
+			}
+			if !ok {
+				return nil, fmt.Errorf("Query: Property %v does not exist in the object: Level=%v", a.name, i)
+			}
+			return w, nil
+		case astType_NumberIndexer:
+			return nil, fmt.Errorf("Query: Object cannot be accessed by number: Level=%v, %v", i, a.index)
+		case astType_Slice:
+			return nil, fmt.Errorf("Query: Object cannot be accessed by slice: Level=%v, %v", i, a.args)
+		case astType_Union:
+			// NOTE: The union of names returns a partial object. Missing keys are skipped.
+			if _, ok := a.args[0].(string); !ok {
+				return nil, fmt.Errorf("Query: Object cannot be accessed by number: Level=%v, %v", i, a.args)
+			}
+			ret := make(map[string]interface{}, len(a.args))
+			for _, arg := range a.args {
+				name := arg.(string)
+				w, ok := z[name]
+				if !ok && c.opts.CaseInsensitive {
+					var err error
+					w, err = lookupKeyFold(z, name, i)
+					ok = err == nil
 				}
+				if ok {
+					ret[name] = w
+				}
+			}
+			return ret, nil
+		}
 
-				end, err = skipSpaces(src, end)
-				if err != nil || end == length {
-					return nil, fmt.Errorf("compileCore: Unexpected termination in the '[' bracket: Pos=%v", start)
+	case OrderedObject:
+		switch a.typ {
+		case astType_NameIndexer:
+			w, ok := z.Get(a.name)
+			if !ok && c.opts.CaseInsensitive {
+				return lookupKeyFold(z.toMap(), a.name, i)
+			}
+			if !ok {
+				return nil, fmt.Errorf("Query: Property %v does not exist in the object: Level=%v", a.name, i)
+			}
+			return w, nil
+		case astType_NumberIndexer:
+			return nil, fmt.Errorf("Query: Object cannot be accessed by number: Level=%v, %v", i, a.index)
+		case astType_Slice:
+			return nil, fmt.Errorf("Query: Object cannot be accessed by slice: Level=%v, %v", i, a.args)
+		case astType_Union:
+			// NOTE: The union of names returns a partial object in the order of the names.
+			if _, ok := a.args[0].(string); !ok {
+				return nil, fmt.Errorf("Query: Object cannot be accessed by number: Level=%v, %v", i, a.args)
+			}
+			ret := make(OrderedObject, 0, len(a.args))
+			for _, arg := range a.args {
+				name := arg.(string)
+				w, ok := z.Get(name)
+				if !ok && c.opts.CaseInsensitive {
+					var err error
+					w, err = lookupKeyFold(z.toMap(), name, i)
+					ok = err == nil
 				}
+				if ok && ret.indexOf(name) < 0 {
+					ret = append(ret, KeyValue{Key: name, Value: w})
+				}
+			}
+			return ret, nil
+		}
 
-				if src[end] != ']' {
-					return nil, fmt.Errorf("compileCore: '[' bracket is not closed: Pos=%v, %v", end, src[end:])
+	case []interface{}:
+		length := len(z)
+		switch a.typ {
+		case astType_NameIndexer:
+			if !c.opts.AutoMapArrays {
+				return nil, fmt.Errorf("Query: Array cannot be accessed by name: Level=%v, %v", i, a.name)
+			}
+			// NOTE: Each item should have the key (nested arrays are also mapped).
+			ret := make([]interface{}, length)
+			for j, w := range z {
+				x, err := p.step(c, i, a, w)
+				if err != nil {
+					return nil, err
 				}
-				i = end // end is ']'
+				ret[j] = x
+			}
+			return ret, nil
+		case astType_NumberIndexer:
+			idx, ok := normalizeIndex(a.index, length)
+			if !ok {
+				if p.isLenientMiss(i) {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, %v", i, length, a.index)
+			}
+			return z[idx], nil
+		case astType_Slice:
+			start, end := sliceRange(a.args[0], a.args[1], length)
+			return z[start:end:end], nil
+		case astType_Union:
+			// NOTE: The union of indices returns an array. Out of range indices are skipped.
+			if _, ok := a.args[0].(int); !ok {
+				return nil, fmt.Errorf("Query: Array cannot be accessed by name: Level=%v, %v", i, a.args)
+			}
+			ret := make([]interface{}, 0, len(a.args))
+			for _, arg := range a.args {
+				if idx, ok := normalizeIndex(arg.(int), length); ok {
+					ret = append(ret, z[idx])
+				}
+			}
+			return ret, nil
+		}
 
-			case '.':
-				end, err = skipSpaces(src, i+1)
-				if err != nil || end == length {
-					return nil, fmt.Errorf("compileCore: Unexpected termination after '.': Pos=%v", i)
+	case string:
+		if p.multi {
+			// NOTE: Strings are indexed only by the single-valued paths,
+			// so that the wildcards and the recursive descents do not yield the characters.
+			return nil, fmt.Errorf("Query: String cannot be accessed in the multi-valued path: Level=%v", i)
+		}
+		switch a.typ {
+		case astType_NumberIndexer:
+			// NOTE: The string is indexed by runes, and the result is a one-character string.
+			runes := []rune(z)
+			idx, ok := normalizeIndex(a.index, len(runes))
+			if !ok {
+				if p.isLenientMiss(i) {
+					return nil, nil
 				}
-				start = end
-				ch2 := src[start]
+				return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, %v", i, len(runes), a.index)
+			}
+			return string(runes[idx]), nil
+		case astType_Slice:
+			runes := []rune(z)
+			start, end := sliceRange(a.args[0], a.args[1], len(runes))
+			return string(runes[start:end]), nil
+		case astType_NameIndexer:
+			return nil, fmt.Errorf("Query: String cannot be accessed by name: Level=%v, %v", i, a.name)
+		case astType_Union:
+			return nil, fmt.Errorf("Query: String cannot be accessed by union: Level=%v, %v", i, a.args)
+		}
+	}
 
-				switch ch2 {
-				case '(':
-					// function
-					end, err = skipSpaces(src, start+1)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Unexpected termination in the '(' parenthesis: Pos=%v", i)
-					}
-					start = end
+	return nil, fmt.Errorf("Query: Unexpected data type appeared: Level=%v", i)
+}
 
-					name, end, err = parseBareName(src, start)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Bad function name expression: Pos=%v, %v", start, src[start:])
-					}
-					asts = append(asts, ast{
-						typ:  astType_Function,
-						name: string(name),
-					})
+// Reports whether the out of range index at the level resolves to null (see LenientIndex).
+// NOTE: Only the last segment is lenient, so that the missing value is not navigated as null.
+// The multi-valued paths skip the out of range index as the missing property.
+// The paths in the filters and the function arguments are not lenient (their opts do not have LenientIndex),
+// so that the filters compare with the missing value (e.g. `$.l[?(@ == $.l[9])]`) as without the option.
+func (p *CompiledJSONPath) isLenientMiss(level int) bool {
+	return p.opts.LenientIndex && !p.multi && level == len(p.asts)-1
+}
 
-					end, err = skipSpaces(src, end)
-					if err != nil || end == length {
-						return nil, fmt.Errorf("compileCore: Unexpected termination in the '(' parenthesis: Pos=%v", start)
-					}
+func lookupKeyFold(m map[string]interface{}, name string, level int) (interface{}, error) {
+	var found []string
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			found = append(found, k)
+		}
+	}
 
-					if src[end] != ')' {
-						return nil, fmt.Errorf("compileCore: '(' parenthesis is not closed: Pos=%v, %v", end, src[end:])
-					}
-					i = end // end is ')'
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("Query: Property %v does not exist in the object: Level=%v", name, level)
+	case 1:
+		return m[found[0]], nil
+	}
+	sort.Strings(found)
+	return nil, fmt.Errorf("Query: Property %v is ambiguous in the object: Level=%v, %v", name, level, found)
+}
 
-				default:
-					// bare name
-					name, end, err = parseBareName(src, start)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Bad name expression: Pos=%v, %v", start, src[start:])
-					}
-					asts = append(asts, ast{
-						typ:  astType_NameIndexer,
-						name: name,
-					})
+// Returns the range of the slice bounds (int or nil) in [0, length].
+// Negative bounds count from the end, omitted bounds are the start and the end, and out of range bounds are clamped.
+func sliceRange(lower, upper interface{}, length int) (int, int) {
+	start, end := 0, length
+	if n, ok := lower.(int); ok {
+		start = clampIndex(n, length)
+	}
+	if n, ok := upper.(int); ok {
+		end = clampIndex(n, length)
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
 
-					end, err = skipSpaces(src, end)
-					if err != nil {
-						return nil, fmt.Errorf("compileCore: Bad name expression: Pos=%v, %v", start, src[start:])
-					}
-					i = end - 1
-				}
+func clampIndex(index, length int) int {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
 
-			default:
-				return nil, fmt.Errorf("compileCore: Unexpected character appeared: Pos=%v, %v", i, src[i:])
-			}
+// NOTE: Object members are visited in the order of sorted keys, so that the results of
+// the wildcards, the recursive descent and the filters are deterministic.
+// OrderedObject members are visited in the source order.
+func children(v interface{}) []interface{} {
+	switch z := v.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(z)
+		ret := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			ret = append(ret, z[k])
+		}
+		return ret
+	case []interface{}:
+		return z
+	case OrderedObject:
+		ret := make([]interface{}, len(z))
+		for i := range z {
+			ret[i] = z[i].Value
 		}
+		return ret
 	}
-
-	return &CompiledJSONPath{
-		asts: asts,
-	}, nil
+	return nil
 }
 
-func (p *CompiledJSONPath) Query(pjson *parsedJSON) (interface{}, error) {
-	if pjson.typ == Type_Invalid {
-		return nil, errors.New("Query: JSON is not read")
+// Appends the value itself and all its descendants in pre-order.
+// The object members are visited in the order of sorted keys (the source order for OrderedObject),
+// and the array items in the index order. The scalars are also appended (e.g. for `$..[?(@ > 1)]`).
+// NOTE: It uses an explicit stack instead of recursion,
+// so the depth of the document is bounded only by memory.
+func appendDescendants(dst []interface{}, v interface{}) []interface{} {
+	stack := []interface{}{v}
+
+	for len(stack) > 0 {
+		w := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		dst = append(dst, w)
+
+		ch := children(w)
+		for i := len(ch) - 1; i >= 0; i-- {
+			stack = append(stack, ch[i])
+		}
 	}
+	return dst
+}
 
-	v := pjson.value
-	var ok bool
-
-	for i, a := range p.asts {
-		if v == nil {
-			return nil, fmt.Errorf("Query: Nil referenced: Level=%v", i)
-		}
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
 
-		switch z := v.(type) {
-		case map[string]interface{}:
-			switch a.typ {
-			case astType_NameIndexer:
-				v, ok = z[a.name]
-				if !ok {
-					return nil, fmt.Errorf("Query: Property %v does not exist in the object: Level=%v", a.name, i)
-				}
-			case astType_NumberIndexer:
-				return nil, fmt.Errorf("Query: Object cannot be accessed by number: Level=%v, %v", i, a.index)
-			case astType_Function:
-				return nil, fmt.Errorf("Query: Object cannot be accessed by function: Level=%v, %v", i, a.name)
-			}
+// Exists reports whether the path points to a value (including null).
+// For the multi-valued path, it reports whether at least one value matches.
+func (p *CompiledJSONPath) Exists(pjson *parsedJSON) bool {
+	if p.opts.LenientIndex {
+		// NOTE: The out of range index does not exist, even though Query resolves it to null.
+		q := *p
+		q.opts.LenientIndex = false
+		p = &q
+	}
+	v, err := p.QueryAll(pjson)
+	return err == nil && len(v) > 0
+}
 
-		case []interface{}:
-			length := len(z)
-			switch a.typ {
-			case astType_NameIndexer:
-				return nil, fmt.Errorf("Query: Array cannot be accessed by name: Level=%v, %v", i, a.name)
-			case astType_NumberIndexer:
-				idx := a.index
-				if idx < 0 {
-					idx = length - idx
-				}
-				if length <= idx {
-					return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, %v", i, length, a.index)
-				}
-				v = z[idx]
-			case astType_Function:
-				switch a.name {
-				case "length":
-					v = length
-				case "first":
-					if length == 0 {
-						return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, (first)", i, length)
-					}
-					v = z[0]
-				case "last":
-					if length == 0 {
-						return nil, fmt.Errorf("Query: Index out of range: Level=%v, length=%v, (last)", i, length)
-					}
-					v = z[length-1]
-				default:
-					return nil, fmt.Errorf("Query: Undefined function name: Level=%v, %v", i, a.name)
-				}
-			}
+// FindFirst returns the first item of the array that the path points to, for which pred returns true.
+// It returns false if no item satisfies pred (including the empty array).
+// It is an error if the path fails or the value is not an array.
+// For the multi-valued path, the items are the matches (in the same order as QueryAll).
+func (p *CompiledJSONPath) FindFirst(pjson *parsedJSON, pred func(value interface{}) bool) (interface{}, bool, error) {
+	v, err := p.Query(pjson)
+	if err != nil {
+		return nil, false, err
+	}
 
-		default:
-			return nil, fmt.Errorf("Query: Unexpected data type appeared: Level=%v", i)
+	z, ok := v.([]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("FindFirst: Value is not an array: %v", typeName(ClassifyValue(v)))
+	}
+	for _, w := range z {
+		if pred(w) {
+			return w, true, nil
 		}
 	}
+	return nil, false, nil
+}
 
-	return v, nil
+// QueryOrDefaultEmpty returns the value that the path points to,
+// or def if the query fails or the value is empty (null, "", {} or [], as the compact function).
+// For the multi-valued path, def is returned if nothing matches.
+func (p *CompiledJSONPath) QueryOrDefaultEmpty(pjson *parsedJSON, def interface{}) interface{} {
+	v, err := p.Query(pjson)
+	if err != nil || isEmptyValue(v) {
+		return def
+	}
+	return v
 }
 
 func (p *CompiledJSONPath) QueryAsStringOrZero(pjson *parsedJSON) string {
@@ -363,7 +1678,7 @@ func (p *CompiledJSONPath) QueryAsNumberOrZero(pjson *parsedJSON) float64 {
 		return 0
 	}
 
-	ret, ok := v.(float64)
+	ret, ok := toFloat64(v)
 	if !ok {
 		return 0
 	}
@@ -382,7 +1697,7 @@ func skipSpaces(src []rune, start int) (int, error) {
 	return length, nil
 }
 
-func parseQuotedName(src []rune, cc rune, start int) (string, int, error) {
+func parseQuotedName(src []rune, cc rune, start int, opts CompileOptions) (string, int, error) {
 	length := len(src)
 	buf := make([]rune, 0, 32)
 
@@ -467,7 +1782,8 @@ func parseQuotedName(src []rune, cc rune, start int) (string, int, error) {
 					if i+5 >= length {
 						return "", start, fmt.Errorf("parseQuotedName: Bad 4 digit unicode escape length (a): Pos=%v", i)
 					}
-					end, err := parseHex(src, i+2)
+					// NOTE: Only 4 digits are read; the following hex-like characters are not a part of the escape (e.g. `\u00e9a`).
+					end, err := parseHex(src[:i+6], i+2)
 					if err != nil {
 						return "", start, fmt.Errorf("parseQuotedName: Cannot parse 4 digit unicode escape: Pos=%v", i)
 					}
@@ -482,6 +1798,15 @@ func parseQuotedName(src []rune, cc rune, start int) (string, int, error) {
 					buf = append(buf, rune(v))
 					i = end - 1
 				}
+
+			default:
+				// NOTE: Unknown escape sequences are errors in the strict mode.
+				// Otherwise the escaped character is taken literally (e.g. `\q` is `q`).
+				if opts.StrictEscapes {
+					return "", start, fmt.Errorf("parseQuotedName: Unknown escape sequence: Pos=%v, \\%v", i, string(src[i+1]))
+				}
+				buf = append(buf, src[i+1])
+				i += 1
 			}
 
 		default:
@@ -491,17 +1816,25 @@ func parseQuotedName(src []rune, cc rune, start int) (string, int, error) {
 	return "", start, fmt.Errorf("parseQuotedName: Unexpected termination: Pos=%v", start)
 }
 
-func parseBareName(src []rune, start int) (string, int, error) {
+// NOTE: A bare name consists of Unicode letters, digits and combining marks
+// (e.g. `café`, `日本語`, `キー1`).
+// Spaces, controls, punctuations and symbols (ASCII or not) terminate the name.
+func isBareNameRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || unicode.IsMark(ch)
+}
+
+func isBareNameRuneWithOptions(ch rune, opts CompileOptions) bool {
+	return isBareNameRune(ch) || opts.ExtendedBareNames && (ch == '-' || ch == '_')
+}
+
+func parseBareName(src []rune, start int, opts CompileOptions) (string, int, error) {
 	length := len(src)
 	buf := make([]rune, 0, 32)
 	var i int
 
 	for i = start; i < length; i++ {
 		ch := src[i]
-		if unicode.IsSpace(ch) || unicode.IsControl(ch) {
-			break
-		}
-		if '!' <= ch && ch <= '/' || ':' <= ch && ch <= '@' || '[' <= ch && ch <= '`' || '{' <= ch && ch <= '~' {
+		if !isBareNameRuneWithOptions(ch, opts) {
 			break
 		}
 		buf = append(buf, src[i])
@@ -513,13 +1846,26 @@ func parseBareName(src []rune, start int) (string, int, error) {
 	return string(buf), i, nil
 }
 
+// Parses the integer of the number indexer or the slice bound.
+func parseIndex(src []rune, start int) (int, int, error) {
+	end, err := parseNumber(src, start)
+	if err != nil {
+		return 0, start, newPathError(start, "compileCore: Bad number expression: Pos=%v, %v", start, string(src[start:]))
+	}
+	num, err := strconv.ParseInt(string(src[start:end]), 10, 64)
+	if err != nil {
+		return 0, start, newPathError(start, "compileCore: Integer cannot be parsed: Pos=%v, %v", start, string(src[start:end]))
+	}
+	return int(num), end, nil
+}
+
 func parseNumber(src []rune, start int) (int, error) {
 	length := len(src)
 	var i int
 
 	for i = start; i < length; i++ {
 		ch := src[i]
-		if i == 0 && ch == '-' {
+		if i == start && ch == '-' {
 			continue
 		}
 		if '0' <= ch && ch <= '9' {
@@ -551,3 +1897,56 @@ func parseHex(src []rune, start int) (int, error) {
 	}
 	return i, nil
 }
+
+func parseFloatNumber(src []rune, start int) (int, error) {
+	length := len(src)
+	i := start
+
+	if i < length && src[i] == '-' {
+		i++
+	}
+	end, err := parseDigits(src, i)
+	if err != nil {
+		return start, errors.New("parseFloatNumber: Empty expression")
+	}
+	i = end
+
+	if i < length && src[i] == '.' {
+		end, err = parseDigits(src, i+1)
+		if err != nil {
+			return start, errors.New("parseFloatNumber: Bad fraction")
+		}
+		i = end
+	}
+
+	if i < length && (src[i] == 'e' || src[i] == 'E') {
+		i++
+		if i < length && (src[i] == '+' || src[i] == '-') {
+			i++
+		}
+		end, err = parseDigits(src, i)
+		if err != nil {
+			return start, errors.New("parseFloatNumber: Bad exponent")
+		}
+		i = end
+	}
+	return i, nil
+}
+
+func parseDigits(src []rune, start int) (int, error) {
+	length := len(src)
+	var i int
+
+	for i = start; i < length; i++ {
+		ch := src[i]
+		if '0' <= ch && ch <= '9' {
+			continue
+		}
+		break
+	}
+
+	if i == start {
+		return start, errors.New("parseDigits: Empty expression")
+	}
+	return i, nil
+}
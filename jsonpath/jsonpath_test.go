@@ -1,7 +1,13 @@
 package jsonpath_test
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/shellyln/go-small-jsonpath/jsonpath"
@@ -140,6 +146,30 @@ func TestCompile(t *testing.T) {
 		path:    `$ [ 'test' ] . (first) [ "\u{0061}\u{00062}\u{000063}" ] `,
 		want:    float64(1),
 		wantErr: false,
+	}, {
+		name:    "22",
+		src:     `[[1,2],[3,4]]`,
+		path:    `$[0][1]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "23",
+		src:     `{"a":[[1,2],[3,4]]}`,
+		path:    `$.a[0][1]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "24",
+		src:     `{"matrix":[[1,2,3],[4,5,6]]}`,
+		path:    `$.matrix[1][2]`,
+		want:    float64(6),
+		wantErr: false,
+	}, {
+		name:    "25",
+		src:     `{"a":[[1,2],[3,[4,5]]]}`,
+		path:    `$["a"] [1] [1][0]`,
+		want:    float64(4),
+		wantErr: false,
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -366,6 +396,92 @@ func TestQueryAsStringOrZero(t *testing.T) {
 	}
 }
 
+func TestQueryOrDefaultEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		path string
+		want interface{}
+	}{{
+		name: "1",
+		src:  `{"a":null}`,
+		path: `$.a`,
+		want: "default",
+	}, {
+		name: "2",
+		src:  `{"a":""}`,
+		path: `$.a`,
+		want: "default",
+	}, {
+		name: "3",
+		src:  `{"a":[]}`,
+		path: `$.a`,
+		want: "default",
+	}, {
+		name: "4",
+		src:  `{"a":{}}`,
+		path: `$.a`,
+		want: "default",
+	}, {
+		name: "5",
+		src:  `{"a":{"b":1}}`,
+		path: `$.c`,
+		want: "default",
+	}, {
+		name: "6",
+		src:  `{"a":[{"b":1}]}`,
+		path: `$.a[*].c`,
+		want: "default",
+	}, {
+		name: "7",
+		src:  `{"a":"x"}`,
+		path: `$.a`,
+		want: "x",
+	}, {
+		name: "8",
+		src:  `{"a":0}`,
+		path: `$.a`,
+		want: float64(0),
+	}, {
+		name: "9",
+		src:  `{"a":false}`,
+		path: `$.a`,
+		want: false,
+	}, {
+		name: "10",
+		src:  `{"a":[null]}`,
+		path: `$.a`,
+		want: []interface{}{nil},
+	}, {
+		name: "11",
+		src:  `{"a":[{"b":1}]}`,
+		path: `$.a[*].b`,
+		want: []interface{}{float64(1)},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v := path.QueryOrDefaultEmpty(json, "default")
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
 func TestFromAny(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -443,3 +559,2816 @@ func TestFromAny(t *testing.T) {
 		})
 	}
 }
+
+func TestUnicodeBareName(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"café":1}`,
+		path:    `$.café`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     "{\"cafe\u0301\":2}",
+		path:    "$.cafe\u0301",
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"日本語":{"キー1":3}}`,
+		path:    `$.日本語.キー1`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"Ωμέγα":[4]}`,
+		path:    `$.Ωμέγα[0]`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `{"a€":5}`,
+		path:    `$.a€`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "6",
+		src:     `{"a、b":6}`,
+		path:    `$.a、b`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "7",
+		src:     `{"€":7}`,
+		path:    `$.€`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Compile: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestFormatPathError(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantPos int
+		want    string
+	}{{
+		name:    "1",
+		path:    `$.a&b`,
+		wantPos: 3,
+		want:    "$.a&b\n   ^",
+	}, {
+		name:    "2",
+		path:    `a.b`,
+		wantPos: 0,
+		want:    "a.b\n^",
+	}, {
+		name:    "3",
+		path:    `$.日本語&b`,
+		wantPos: 5,
+		want:    "$.日本語&b\n     ^",
+	}, {
+		name:    "4",
+		path:    "$\t.a&",
+		wantPos: 4,
+		want:    "$\t.a&\n \t  ^",
+	}, {
+		name:    "5",
+		path:    `$['a'`,
+		wantPos: 5,
+		want:    "$['a'\n     ^",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				t.Errorf("%v: Compile: want error", tt.name)
+				return
+			}
+
+			var pe *jsonpath.PathError
+			if !errors.As(err, &pe) {
+				t.Errorf("%v: Compile: error is not a PathError: %v", tt.name, err)
+				return
+			}
+			if pe.Pos != tt.wantPos {
+				t.Errorf("%v: Pos = %v, want = %v", tt.name, pe.Pos, tt.wantPos)
+				return
+			}
+
+			s := jsonpath.FormatPathError(tt.path, err)
+			want := err.Error() + "\n" + tt.want
+			if s != want {
+				t.Errorf("%v: s = %q, want = %q", tt.name, s, want)
+				return
+			}
+		})
+	}
+
+	if s := jsonpath.FormatPathError(`$`, errors.New("foo")); s != "foo" {
+		t.Errorf("FormatPathError: s = %q, want = %q", s, "foo")
+	}
+	if s := jsonpath.FormatPathError(`$`, nil); s != "" {
+		t.Errorf("FormatPathError: s = %q, want = %q", s, "")
+	}
+}
+
+func TestCompileBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.foo['a b'][-1].(take 2)`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.日本語[?(@.x == 'ü')]..*`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.foo[`,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := jsonpath.Compile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileBytes([]byte(tt.path))
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("%v: CompileBytes: error = %v", tt.name, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("%v: CompileBytes: want error", tt.name)
+				return
+			}
+			if !path.Equal(want) {
+				t.Errorf("%v: path = %v, want = %v", tt.name, path.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestCompilePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantLen int
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `$.a.b`,
+		wantLen: 5,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `$.a.b + 1`,
+		wantLen: 5,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `$.a['b'], $.c`,
+		wantLen: 8,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `$.c.(length)}}`,
+		wantLen: 12,
+		want:    int(2),
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `$.c[1] == 3`,
+		wantLen: 6,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `$ ;`,
+		wantLen: 1,
+		want:    map[string]interface{}{"a": map[string]interface{}{"b": float64(1)}, "c": []interface{}{float64(2), float64(3)}, "日本": float64(4)},
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `$.日本-語`,
+		wantLen: 4,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     `$.c[1 + 2`,
+		wantLen: 0,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		src:     `foo`,
+		wantLen: 0,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(`{"a":{"b":1},"c":[2,3],"日本":4}`)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, n, err := jsonpath.CompilePrefix(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: CompilePrefix: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: CompilePrefix: error = %v", tt.name, err)
+				return
+			}
+			if n != tt.wantLen {
+				t.Errorf("%v: n = %v, want = %v", tt.name, n, tt.wantLen)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestReadValue(t *testing.T) {
+	yamlShaped := map[interface{}]interface{}{
+		"name": "foo",
+		"spec": map[interface{}]interface{}{
+			"replicas": 3,
+			"ports": []interface{}{
+				map[interface{}]interface{}{"port": 80, "ratio": float32(0.5)},
+				map[interface{}]interface{}{"port": int64(443)},
+			},
+			1:     "one",
+			2.5:   "two and a half",
+			true:  "yes",
+			nil:   "nothing",
+			"map": map[string]interface{}{"x": uint8(7)},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		src     interface{}
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     yamlShaped,
+		path:    `$.name`,
+		want:    "foo",
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     yamlShaped,
+		path:    `$.spec.replicas`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     yamlShaped,
+		path:    `$.spec.ports[1].port`,
+		want:    float64(443),
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     yamlShaped,
+		path:    `$.spec.ports[0]`,
+		want:    map[string]interface{}{"port": float64(80), "ratio": float64(0.5)},
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     yamlShaped,
+		path:    `$.spec['1']`,
+		want:    "one",
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     yamlShaped,
+		path:    `$.spec['2.5']`,
+		want:    "two and a half",
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     yamlShaped,
+		path:    `$.spec['true']`,
+		want:    "yes",
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     yamlShaped,
+		path:    `$.spec['null']`,
+		want:    "nothing",
+		wantErr: false,
+	}, {
+		name:    "9",
+		src:     yamlShaped,
+		path:    `$.spec.map.x`,
+		want:    float64(7),
+		wantErr: false,
+	}, {
+		name:    "10",
+		src:     map[interface{}]interface{}{"a": struct{}{}},
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "11",
+		src:     map[interface{}]interface{}{[2]int{1, 2}: 1},
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "12",
+		src:     map[string]interface{}{"n": json.Number("1.5e2")},
+		path:    `$.n`,
+		want:    float64(150),
+		wantErr: false,
+	}, {
+		name:    "13",
+		src:     []interface{}{json.Number("x")},
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "14",
+		src:     map[string]interface{}{"a": []string{"x", "y"}},
+		path:    `$.a`,
+		want:    []interface{}{"x", "y"},
+		wantErr: false,
+	}, {
+		name:    "15",
+		src:     map[string][]int{"a": {1, 2}},
+		path:    `$.a[1]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "16",
+		src:     []map[int]interface{}{{1: [2]float32{0.5, 1}}},
+		path:    `$[0]['1']`,
+		want:    []interface{}{float64(0.5), float64(1)},
+		wantErr: false,
+	}, {
+		name:    "17",
+		src:     []struct{}{{}},
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadValue(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: ReadValue: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: ReadValue: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestEmptyBareName(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantPos int
+	}{{
+		name:    "1",
+		path:    `$.a...b`,
+		wantPos: 5,
+	}, {
+		name:    "2",
+		path:    `$.a.[0]`,
+		wantPos: 4,
+	}, {
+		name:    "3",
+		path:    `$.a. .b`,
+		wantPos: 5,
+	}, {
+		name:    "4",
+		path:    `$..`,
+		wantPos: 2,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jsonpath.Compile(tt.path)
+			var pe *jsonpath.PathError
+			if !errors.As(err, &pe) {
+				t.Errorf("%v: Compile: want PathError: error = %v", tt.name, err)
+				return
+			}
+			if pe.Pos != tt.wantPos {
+				t.Errorf("%v: Pos = %v, want = %v: %v", tt.name, pe.Pos, tt.wantPos, err)
+				return
+			}
+		})
+	}
+}
+
+func TestReadStringWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		opts    jsonpath.ReadOptions
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `+5`,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `+5.5`,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    float64(5.5),
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     ` +5 `,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `+5`,
+		opts:    jsonpath.ReadOptions{},
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "5",
+		src:     `++5`,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "6",
+		src:     `+-5`,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "7",
+		src:     `-5`,
+		opts:    jsonpath.ReadOptions{AllowLeadingPlus: true},
+		want:    float64(-5),
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadStringWithOptions(tt.src, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: ReadStringWithOptions: want error: v = %v", tt.name, json.Root())
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: ReadStringWithOptions: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(json.Root(), tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, json.Root(), tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{{
+		name: "1",
+		path: `$`,
+		want: 0,
+	}, {
+		name: "2",
+		path: `$.a['b'][0]`,
+		want: 3,
+	}, {
+		name: "3",
+		path: `$.a.(length)`,
+		want: 2,
+	}, {
+		name: "4",
+		path: `$..a`,
+		want: 2,
+	}, {
+		name: "5",
+		path: `$.items[?(@.a.b.c == 1)].x`,
+		want: 3,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			if d := path.Depth(); d != tt.want {
+				t.Errorf("%v: Depth = %v, want = %v", tt.name, d, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestReadValueInternKeys(t *testing.T) {
+	intern := make(map[string]string)
+	opts := jsonpath.ReadOptions{InternKeys: intern}
+
+	for i := 0; i < 100; i++ {
+		// NOTE: Allocates the keys for each document.
+		doc := map[interface{}]interface{}{
+			string([]byte("name")): "foo",
+			i % 2:                  []interface{}{map[string]interface{}{string([]byte("id")): i}},
+		}
+
+		json, err := jsonpath.ReadValueWithOptions(doc, opts)
+		if err != nil {
+			t.Errorf("ReadValueWithOptions: error = %v", err)
+			return
+		}
+
+		if v, _ := json.Root().(map[string]interface{})["name"]; v != "foo" {
+			t.Errorf("name = %v, want = %v", v, "foo")
+			return
+		}
+
+		path, err := jsonpath.Compile(`$['` + strconv.Itoa(i%2) + `'][0].id`)
+		if err != nil {
+			t.Errorf("Compile: error = %v", err)
+			return
+		}
+		v, err := path.Query(json)
+		if err != nil {
+			t.Errorf("Query: error = %v", err)
+			return
+		}
+		if v != float64(i) {
+			t.Errorf("v = %v, want = %v", v, i)
+			return
+		}
+	}
+
+	if len(intern) != 4 {
+		t.Errorf("len(intern) = %v, want = %v: %v", len(intern), 4, intern)
+		return
+	}
+}
+
+// NOTE: The retained bytes per document show that the interned keys share one backing string.
+func benchmarkReadValueKeys(b *testing.B, intern map[string]string) {
+	key := strings.Repeat("k", 4096)
+	docs := make([]interface{}, 0, b.N)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// NOTE: Allocates the key for each document.
+		doc := map[string]interface{}{string([]byte(key)): float64(i)}
+		json, err := jsonpath.ReadValueWithOptions(doc, jsonpath.ReadOptions{InternKeys: intern})
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs = append(docs, json.Root())
+	}
+	b.StopTimer()
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "retained-B/doc")
+	runtime.KeepAlive(docs)
+}
+
+func BenchmarkReadValueInternKeys(b *testing.B) {
+	benchmarkReadValueKeys(b, make(map[string]string))
+}
+
+func BenchmarkReadValueNoInternKeys(b *testing.B) {
+	benchmarkReadValueKeys(b, nil)
+}
+
+func TestQuotedBracketName(t *testing.T) {
+	const src = `{"a b c":1,"a\tb":2,"a\nb":3,"é":4,"éa":5,"AB":6,"a\u0000b":7}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$['a b c']`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$["a\tb"]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$['a\nb']`,
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    "$['a\tb']",
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    "$[ \"a\nb\" ]",
+		want:    float64(3),
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$["\u00e9"]`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$["\u00e9a"]`,
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$["\u0041B"]`,
+		want:    float64(6),
+		wantErr: false,
+	}, {
+		name:    "9",
+		path:    `$['a\x00b']`,
+		want:    float64(7),
+		wantErr: false,
+	}, {
+		name:    "10",
+		path:    `$['a\u{9}b']`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "11",
+		path:    `$["\u00e"]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "12",
+		path:    `$['a b c`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "13",
+		path:    `$.a b c`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Compile: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+
+			path2, err := jsonpath.Compile(path.String())
+			if err != nil {
+				t.Errorf("%v: Compile (2): error = %v", tt.name, err)
+				return
+			}
+			if v2, err := path2.Query(json); err != nil || !reflect.DeepEqual(v2, tt.want) {
+				t.Errorf("%v: v2 = %v, want = %v, error = %v", tt.name, v2, tt.want, err)
+				return
+			}
+		})
+	}
+}
+
+func TestQueryTyped2(t *testing.T) {
+	const src = `{"n":null,"num":1.5,"s":"x","b":false,"o":{"a":1},"a":[1,2]}`
+
+	tests := []struct {
+		name     string
+		path     string
+		want     interface{}
+		wantType jsonpath.JSONValueType
+		wantErr  bool
+	}{{
+		name:     "1",
+		path:     `$.n`,
+		want:     nil,
+		wantType: jsonpath.Type_Null,
+	}, {
+		name:     "2",
+		path:     `$.num`,
+		want:     float64(1.5),
+		wantType: jsonpath.Type_Number,
+	}, {
+		name:     "3",
+		path:     `$.s`,
+		want:     "x",
+		wantType: jsonpath.Type_String,
+	}, {
+		name:     "4",
+		path:     `$.b`,
+		want:     false,
+		wantType: jsonpath.Type_Boolean,
+	}, {
+		name:     "5",
+		path:     `$.o`,
+		want:     map[string]interface{}{"a": float64(1)},
+		wantType: jsonpath.Type_Object,
+	}, {
+		name:     "6",
+		path:     `$.a`,
+		want:     []interface{}{float64(1), float64(2)},
+		wantType: jsonpath.Type_Array,
+	}, {
+		name:     "7",
+		path:     `$.a.(length)`,
+		want:     2,
+		wantType: jsonpath.Type_Number,
+	}, {
+		name:     "8",
+		path:     `$.o..a`,
+		want:     []interface{}{float64(1)},
+		wantType: jsonpath.Type_Array,
+	}, {
+		name:     "9",
+		path:     `$.x`,
+		want:     nil,
+		wantType: jsonpath.Type_Invalid,
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, typ, err := path.QueryTyped2(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: QueryTyped2: want error: v = %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: QueryTyped2: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+			if typ != tt.wantType {
+				t.Errorf("%v: type = %v, want = %v", tt.name, typ, tt.wantType)
+				return
+			}
+		})
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	const src = `{"Name":1,"name":2,"Title":3,"TITLE":4,"Item":{"Id":5},"list":[{"Kind":"a"},{"kind":"b"},{"KIND":"c","kind":"d"}]}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.name`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.Name`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.NAME`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "4",
+		path:    `$.title`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "5",
+		path:    `$.TITLE`,
+		want:    float64(4),
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.item.ID`,
+		want:    float64(5),
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$.list[?(@.kind != 'x')].kind`,
+		want:    []interface{}{"a", "b", "d"},
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$.missing`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{CaseInsensitive: true})
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestReadStringIndented(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     "\n\n\t\t\t\t{\n\t\t\t\t\t\"a\": [\n\t\t\t\t\t\t1,\n\t\t\t\t\t\t2\n\t\t\t\t\t]\n\t\t\t\t}\n\n",
+		path:    `$.a[1]`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     "\r\n\t[\r\n\t\t{ \"a\" : 1 }\r\n\t]\r\n",
+		path:    `$[0].a`,
+		want:    float64(1),
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     "\t\t\"x\"\t\t",
+		path:    `$`,
+		want:    "x",
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     "\n\ttrue\n",
+		path:    `$`,
+		want:    true,
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     "\n\tnull\n\t",
+		path:    `$`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     "\n\t-1.5e2\n\t",
+		path:    `$`,
+		want:    float64(-150),
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     "\n\t \r\n",
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "8",
+		src:     "\n\tnullx\n\t",
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		src:     "\u00a0{}",
+		path:    `$`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "10",
+		src:     " {}",
+		path:    `$`,
+		want:    map[string]interface{}{},
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: ReadString: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestReadWithLimit(t *testing.T) {
+	const src = `{"a":[1,2,3]}` // 13 bytes
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		wantErr  bool
+	}{{
+		name:     "1",
+		maxBytes: 12,
+		wantErr:  true,
+	}, {
+		name:     "2",
+		maxBytes: 13,
+		wantErr:  false,
+	}, {
+		name:     "3",
+		maxBytes: 14,
+		wantErr:  false,
+	}, {
+		name:     "4",
+		maxBytes: 0,
+		wantErr:  true,
+	}, {
+		name:     "5",
+		maxBytes: -1,
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, read := range []func() (interface{}, error){
+				func() (interface{}, error) {
+					return jsonpath.ReadStringWithLimit(src, tt.maxBytes)
+				},
+				func() (interface{}, error) {
+					return jsonpath.ReadReaderWithLimit(strings.NewReader(src), tt.maxBytes)
+				},
+			} {
+				json, err := read()
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("%v: want error", tt.name)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%v: error = %v", tt.name, err)
+					continue
+				}
+				if json == nil {
+					t.Errorf("%v: json is nil", tt.name)
+				}
+			}
+		})
+	}
+
+	// The negative limit is rejected before the source is checked (also for the empty source).
+	if _, err := jsonpath.ReadStringWithLimit("", -1); err == nil || !strings.Contains(err.Error(), "Bad size limit") {
+		t.Errorf("ReadStringWithLimit: error = %v, want bad size limit", err)
+	}
+
+	// NOTE: The reader is not read beyond the limit.
+	r := strings.NewReader(src + strings.Repeat(" ", 1000))
+	if _, err := jsonpath.ReadReaderWithLimit(r, 20); err == nil {
+		t.Errorf("ReadReaderWithLimit: want error")
+	}
+	if r.Len() != len(src)+1000-21 {
+		t.Errorf("remaining = %v, want = %v", r.Len(), len(src)+1000-21)
+	}
+
+	json, err := jsonpath.ReadReaderWithLimit(strings.NewReader(src), 100)
+	if err != nil {
+		t.Errorf("ReadReaderWithLimit: error = %v", err)
+		return
+	}
+	path, err := jsonpath.Compile(`$.a[2]`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+	if v, err := path.Query(json); err != nil || v != float64(3) {
+		t.Errorf("v = %v, error = %v", v, err)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	const src = `{"a":1,"b":{"x":2},"c":null,"arr":[10,11,12]}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$['a','b','c']`,
+		want:    map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"x": float64(2)}, "c": nil},
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$[ 'a' , "missing" ,'b' ]`,
+		want:    map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"x": float64(2)}},
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$['x','y']`,
+		want:    map[string]interface{}{},
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$['a','b'].b.x`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.arr[2,0,5]`,
+		want:    []interface{}{float64(12), float64(10)},
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.arr['a','b']`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "7",
+		path:    `$[0,1]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "8",
+		path:    `$['a',0]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		path:    `$['a',]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "10",
+		path:    `$[*,'a']`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				var v interface{}
+				v, err = path.Query(json)
+				if err == nil {
+					if tt.wantErr {
+						t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+						return
+					}
+					if !reflect.DeepEqual(v, tt.want) {
+						t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					}
+					return
+				}
+			}
+
+			if !tt.wantErr {
+				t.Errorf("%v: error = %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	tests := []struct {
+		name string
+		a    interface{}
+		b    interface{}
+		want bool
+	}{{
+		name: "1",
+		a:    nil,
+		b:    nil,
+		want: true,
+	}, {
+		name: "2",
+		a:    float64(1),
+		b:    1,
+		want: true,
+	}, {
+		name: "3",
+		a:    float64(1.5),
+		b:    1,
+		want: false,
+	}, {
+		name: "4",
+		a:    "1",
+		b:    float64(1),
+		want: false,
+	}, {
+		name: "5",
+		a:    false,
+		b:    nil,
+		want: false,
+	}, {
+		name: "6",
+		a:    map[string]interface{}{"a": float64(1), "b": []interface{}{"x", true}},
+		b:    map[string]interface{}{"b": []interface{}{"x", true}, "a": 1},
+		want: true,
+	}, {
+		name: "7",
+		a:    map[string]interface{}{"a": float64(1)},
+		b:    map[string]interface{}{"a": float64(1), "b": nil},
+		want: false,
+	}, {
+		name: "8",
+		a:    map[string]interface{}{"a": nil},
+		b:    map[string]interface{}{"b": nil},
+		want: false,
+	}, {
+		name: "9",
+		a:    []interface{}{float64(1), float64(2)},
+		b:    []interface{}{2, 1},
+		want: false,
+	}, {
+		name: "10",
+		a:    []interface{}{map[string]interface{}{"o": map[string]interface{}{"x": 1, "y": []interface{}{}}}},
+		b:    []interface{}{map[string]interface{}{"o": map[string]interface{}{"y": []interface{}{}, "x": float64(1)}}},
+		want: true,
+	}, {
+		name: "11",
+		a:    []interface{}{},
+		b:    map[string]interface{}{},
+		want: false,
+	}, {
+		name: "12",
+		a:    []interface{}{nil},
+		b:    []interface{}{},
+		want: false,
+	}, {
+		name: "13",
+		a:    json.Number("1"),
+		b:    json.Number("1"),
+		want: true,
+	}, {
+		name: "14",
+		a:    json.Number("1"),
+		b:    float64(1),
+		want: true,
+	}, {
+		name: "15",
+		a:    json.Number("1.0"),
+		b:    1,
+		want: true,
+	}, {
+		name: "16",
+		a:    json.Number("1"),
+		b:    "1",
+		want: false,
+	}, {
+		name: "17",
+		a:    map[string]interface{}{"a": []interface{}{json.Number("2")}},
+		b:    map[string]interface{}{"a": []interface{}{float64(2)}},
+		want: true,
+	}}
+
+	for _, tt := range tests {
+		if got := jsonpath.Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("%v: Equal() = %v, want = %v", tt.name, got, tt.want)
+		}
+		if got := jsonpath.Equal(tt.b, tt.a); got != tt.want {
+			t.Errorf("%v: Equal() (swapped) = %v, want = %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAutoMapArrays(t *testing.T) {
+	const src = `{"items":[{"name":"a","tags":[{"id":1},{"id":2}]},{"name":"b","tags":[]}],"mixed":[{"name":"a"},{"id":1}],"empty":[]}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.items.name`,
+		want:    []interface{}{"a", "b"},
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.items.tags.id`,
+		want:    []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{}},
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.items[1].name`,
+		want:    "b",
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.empty.name`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.mixed.name`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "6",
+		path:    `$.items.name.x`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{AutoMapArrays: true})
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+				return
+			}
+		})
+	}
+
+	json, _ := jsonpath.ReadString(src)
+	path, _ := jsonpath.Compile(`$.items.name`)
+	if v, err := path.Query(json); err == nil {
+		t.Errorf("Query (default): want error: v = %v", v)
+	}
+}
+
+func TestNullIntermediate(t *testing.T) {
+	const src = `{"a":null,"b":{"c":null},"d":[null],"e":{}}`
+
+	tests := []struct {
+		name     string
+		src      string
+		path     string
+		wantNull bool
+		wantMsg  string
+	}{{
+		name:     "1",
+		src:      src,
+		path:     `$.a.b`,
+		wantNull: true,
+		wantMsg:  "$.a",
+	}, {
+		name:     "2",
+		src:      src,
+		path:     `$.b.c[0]`,
+		wantNull: true,
+		wantMsg:  "$.b.c",
+	}, {
+		name:     "3",
+		src:      src,
+		path:     `$.d[0].x`,
+		wantNull: true,
+		wantMsg:  "$.d[0]",
+	}, {
+		name:     "4",
+		src:      src,
+		path:     `$.x.b`,
+		wantNull: false,
+	}, {
+		name:     "5",
+		src:      src,
+		path:     `$.e.c.d`,
+		wantNull: false,
+	}, {
+		name:     "6",
+		src:      `null`,
+		path:     `$.a`,
+		wantNull: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err == nil {
+				t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				return
+			}
+			if errors.Is(err, jsonpath.ErrNullIntermediate) != tt.wantNull {
+				t.Errorf("%v: Query: error = %v, wantNull = %v", tt.name, err, tt.wantNull)
+				return
+			}
+			if tt.wantNull && !strings.HasSuffix(err.Error(), tt.wantMsg) {
+				t.Errorf("%v: Query: error = %v, want suffix = %v", tt.name, err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDisableWildcards(t *testing.T) {
+	const src = `{"a":{"b":[{"c":1},{"c":2}]},"x":1}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.a.b[1].c`,
+		want:    float64(2),
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.a.b[?(@.c > 1)].c`,
+		want:    []interface{}{float64(2)},
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$..c`,
+		wantErr: true,
+	}, {
+		name:    "4",
+		path:    `$.a..[0]`,
+		wantErr: true,
+	}, {
+		name:    "5",
+		path:    `$.a.*`,
+		wantErr: true,
+	}, {
+		name:    "6",
+		path:    `$.a.b[*]`,
+		wantErr: true,
+	}, {
+		name:    "7",
+		path:    `$['a','x']`,
+		wantErr: true,
+	}, {
+		name:    "8",
+		path:    `$.a.b[0,1]`,
+		wantErr: true,
+	}, {
+		name:    "9",
+		path:    `$.a.b[?(@[0,1] == 1)]`,
+		wantErr: true,
+	}, {
+		name:    "10",
+		path:    `$.a.b[?(@.c == $['x','a'])]`,
+		wantErr: true,
+	}, {
+		name:    "11",
+		path:    `$.a.b.(findIndex !@['c','d'])`,
+		wantErr: true,
+	}, {
+		name:    "12",
+		path:    `$.a.b[0:2]`,
+		wantErr: true,
+	}, {
+		name:    "13",
+		path:    `$.a.b[?(@.c == $.a.b[:1])]`,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			if _, err := jsonpath.Compile(tt.path); err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{DisableWildcards: true})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: CompileWithOptions: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: CompileWithOptions: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkMatches(t *testing.T) {
+	const src = `{"a":[{"x":1,"y":{"x":2}},{"x":3}],"b":{"x":4},"z":[5,6,7],"s":"héllo","d":{"v":[1,2],"e":{"v":[3]}}}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	for _, p := range []string{`$..x`, `$.a[*].x`, `$.z.*`, `$.a[?(@.x >= 1)].x`, `$.a[0].x`, `$..[?(@.x)].x`, `$.missing[*]`} {
+		path, err := jsonpath.Compile(p)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", p, err)
+			return
+		}
+		want, err := path.QueryAll(json)
+		if err != nil {
+			t.Errorf("%v: QueryAll: error = %v", p, err)
+			return
+		}
+
+		got := make([]interface{}, 0)
+		err = path.WalkMatches(json, func(v interface{}) error {
+			got = append(got, v)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%v: WalkMatches: error = %v", p, err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got = %v, want = %v", p, got, want)
+		}
+	}
+
+	path, _ := jsonpath.Compile(`$..x`)
+	stop := errors.New("stop")
+	n := 0
+	err = path.WalkMatches(json, func(v interface{}) error {
+		n++
+		if v == float64(2) {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("WalkMatches: error = %v, want = %v", err, stop)
+	}
+	if n != 2 {
+		t.Errorf("WalkMatches: called %v times, want = %v", n, 2)
+	}
+
+	path, _ = jsonpath.Compile(`$.a[5]`)
+	if err := path.WalkMatches(json, func(v interface{}) error { return nil }); err == nil {
+		t.Errorf("WalkMatches: want error")
+	}
+
+	// The items of the unions and the slices are visited one by one.
+	for _, tt := range []struct {
+		path string
+		want []interface{}
+	}{
+		{path: `$.z[0,2]`, want: []interface{}{float64(5), float64(7)}},
+		{path: `$.z[1:]`, want: []interface{}{float64(6), float64(7)}},
+		{path: `$[*][-1,0].x`, want: []interface{}{float64(3), float64(1)}},
+		{path: `$..v[0,1]`, want: []interface{}{float64(1), float64(2), float64(3)}},
+		{path: `$.b['x','w']`, want: []interface{}{map[string]interface{}{"x": float64(4)}}},
+		{path: `$.s[1:3]`, want: []interface{}{"él"}},
+		{path: `$.s[0,1]`, want: nil},
+		{path: `$.a[0,1][1]`, want: []interface{}{map[string]interface{}{"x": float64(3)}}},
+		{path: `$.a[0:2].x`, want: nil},
+		{path: `$.missing[0,1]`, want: nil},
+	} {
+		path, err := jsonpath.Compile(tt.path)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", tt.path, err)
+			return
+		}
+		got := make([]interface{}, 0)
+		err = path.WalkMatches(json, func(v interface{}) error {
+			got = append(got, v)
+			return nil
+		})
+		if tt.want == nil {
+			// Like Query, the single-valued path is an error.
+			if err == nil {
+				t.Errorf("%v: WalkMatches: want error", tt.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: WalkMatches: error = %v", tt.path, err)
+			return
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got = %v, want = %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFastPath(t *testing.T) {
+	const src = `{"a":{"b":[{"c":1},{"c":null}],"n":null,"Name":"x"},"arr":[[1,2],[3]]}`
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	paths := []string{
+		`$`, `$.a`, `$.a.b[0].c`, `$.a.b[1].c`, `$.arr[1][0]`, `$.a.b[2]`, `$.a.b.c`, `$.a.n.x`,
+		`$.a.x`, `$.arr[0].a`, `$.a.name`, `$.a['Name']`,
+	}
+	for _, opts := range []jsonpath.CompileOptions{{}, {CaseInsensitive: true}, {AutoMapArrays: true}} {
+		for _, p := range paths {
+			path, err := jsonpath.CompileWithOptions(p, opts)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", p, err)
+				return
+			}
+			generic := jsonpath.WithoutFastPath(path)
+
+			v1, err1 := path.Query(json)
+			v2, err2 := generic.Query(json)
+			if !reflect.DeepEqual(v1, v2) {
+				t.Errorf("%v: %+v: v = %v, want = %v", p, opts, v1, v2)
+			}
+			if (err1 == nil) != (err2 == nil) || err1 != nil && err1.Error() != err2.Error() {
+				t.Errorf("%v: %+v: error = %v, want = %v", p, opts, err1, err2)
+			}
+		}
+	}
+}
+
+func benchmarkQuery(b *testing.B, fast bool) {
+	json, err := jsonpath.ReadString(`{"a":{"b":{"c":[{"d":1},{"d":2}]}}}`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	path, err := jsonpath.Compile(`$.a.b.c[1].d`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !fast {
+		path = jsonpath.WithoutFastPath(path)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := path.Query(json); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryFastPath(b *testing.B) {
+	benchmarkQuery(b, true)
+}
+
+func BenchmarkQueryGeneric(b *testing.B) {
+	benchmarkQuery(b, false)
+}
+
+func TestExtendedBareNames(t *testing.T) {
+	const src = `{"first-name":"Ada","user_id":1,"a":{"-":2,"_x_":3},"items":[{"first-name":"a"},{"first-name":"b"}]}`
+
+	tests := []struct {
+		name       string
+		path       string
+		want       interface{}
+		wantString string
+		wantErr    bool
+	}{{
+		name:       "1",
+		path:       `$.first-name`,
+		want:       "Ada",
+		wantString: `$['first-name']`,
+	}, {
+		name:       "2",
+		path:       `$.user_id`,
+		want:       float64(1),
+		wantString: `$['user_id']`,
+	}, {
+		name:       "3",
+		path:       `$.a.-`,
+		want:       float64(2),
+		wantString: `$.a['-']`,
+	}, {
+		name:       "4",
+		path:       `$.a._x_`,
+		want:       float64(3),
+		wantString: `$.a['_x_']`,
+	}, {
+		name:       "5",
+		path:       `$.items[?(@.first-name == 'b')].first-name`,
+		want:       []interface{}{"b"},
+		wantString: `$.items[?(@['first-name'] == 'b')]['first-name']`,
+	}, {
+		name:    "6",
+		path:    `$.first+name`,
+		wantErr: true,
+	}, {
+		name:    "7",
+		path:    `$.(first-name)`,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{ExtendedBareNames: true})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: CompileWithOptions: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: CompileWithOptions: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+			if s := path.String(); s != tt.wantString {
+				t.Errorf("%v: String() = %v, want = %v", tt.name, s, tt.wantString)
+			}
+
+			if _, err := jsonpath.Compile(tt.path); err == nil {
+				t.Errorf("%v: Compile (default): want error", tt.name)
+			}
+		})
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	const src = `{"s":"abc","j":"日本語","e":"","arr":[10,11,12]}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.s[0]`,
+		want:    "a",
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.s[-1]`,
+		want:    "c",
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.j[1]`,
+		want:    "本",
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.j[-3]`,
+		want:    "日",
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.j[3]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "6",
+		path:    `$.s[-4]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "7",
+		path:    `$.e[0]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "8",
+		path:    `$.s.a`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		path:    `$.arr[-1]`,
+		want:    float64(12),
+		wantErr: false,
+	}, {
+		name:    "10",
+		path:    `$.arr[-3]`,
+		want:    float64(10),
+		wantErr: false,
+	}, {
+		name:    "11",
+		path:    `$.arr[-4]`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(json)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("%v: Query: error = %v", tt.name, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringIndexInMultiValuedPath(t *testing.T) {
+	const src = `{"a":["xy","z"],"s":"hello"}`
+
+	tests := []struct {
+		name   string
+		path   string
+		want   []interface{}
+		walked []interface{} // nil if the same as want
+	}{{
+		name: "1",
+		path: `$..[0]`,
+		want: []interface{}{"xy"},
+	}, {
+		name: "2",
+		path: `$.a[*][0]`,
+		want: []interface{}{},
+	}, {
+		name:   "3",
+		path:   `$.*[1:]`,
+		want:   []interface{}{[]interface{}{"z"}},
+		walked: []interface{}{"z"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.QueryAll(json)
+			if err != nil {
+				t.Errorf("%v: QueryAll: error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: QueryAll: v = %v, want = %v", tt.name, v, tt.want)
+			}
+
+			wantWalked := tt.walked
+			if wantWalked == nil {
+				wantWalked = tt.want
+			}
+
+			walked := []interface{}{}
+			err = path.WalkMatches(json, func(value interface{}) error {
+				walked = append(walked, value)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("%v: WalkMatches: error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(walked, wantWalked) {
+				t.Errorf("%v: WalkMatches: v = %v, want = %v", tt.name, walked, wantWalked)
+			}
+
+			r, err := path.QueryCursor(json)
+			if err != nil {
+				t.Errorf("%v: QueryCursor: error = %v", tt.name, err)
+				return
+			}
+			iterated := []interface{}{}
+			for r.Next() {
+				iterated = append(iterated, r.Value())
+			}
+			if !reflect.DeepEqual(iterated, wantWalked) {
+				t.Errorf("%v: QueryCursor: v = %v, want = %v", tt.name, iterated, wantWalked)
+			}
+		})
+	}
+}
+
+func TestStrictEscapes(t *testing.T) {
+	const src = `{"q":1,"\t":2,"o":{"q":3},"items":[{"a":"q"},{"a":"x"}]}`
+
+	tests := []struct {
+		name          string
+		path          string
+		want          interface{}
+		wantStrictErr bool
+	}{{
+		name:          "1",
+		path:          `$['\q']`,
+		want:          float64(1),
+		wantStrictErr: true,
+	}, {
+		name:          "2",
+		path:          `$["\q"]`,
+		want:          float64(1),
+		wantStrictErr: true,
+	}, {
+		name:          "3",
+		path:          `$['\t']`,
+		want:          float64(2),
+		wantStrictErr: false,
+	}, {
+		name:          "4",
+		path:          `$['\'']`,
+		want:          nil,
+		wantStrictErr: false,
+	}, {
+		name:          "5",
+		path:          `$['\q','o']`,
+		want:          map[string]interface{}{"q": float64(1), "o": map[string]interface{}{"q": float64(3)}},
+		wantStrictErr: true,
+	}, {
+		name:          "6",
+		path:          `$.items[?(@.a == '\q')].a`,
+		want:          []interface{}{"q"},
+		wantStrictErr: true,
+	}, {
+		name:          "7",
+		path:          `$.o.(coalesceKeys 'x' '\q')`,
+		want:          float64(3),
+		wantStrictErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			v, err := path.Query(json)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				}
+			} else if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+			} else if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+
+			_, err = jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{StrictEscapes: true})
+			if (err != nil) != tt.wantStrictErr {
+				t.Errorf("%v: CompileWithOptions: error = %v, wantStrictErr = %v", tt.name, err, tt.wantStrictErr)
+			}
+		})
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	const src = `{"a":[1,{"id":2,"ok":true},{"id":3,"ok":true}],"e":[],"o":{"x":1},"s":"abc"}`
+
+	hasOK := func(v interface{}) bool {
+		m, ok := v.(map[string]interface{})
+		return ok && m["ok"] == true
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		want      interface{}
+		wantFound bool
+		wantErr   bool
+	}{{
+		name:      "1",
+		path:      `$.a`,
+		want:      map[string]interface{}{"id": float64(2), "ok": true},
+		wantFound: true,
+		wantErr:   false,
+	}, {
+		name:      "2",
+		path:      `$.a.(take 1)`,
+		want:      nil,
+		wantFound: false,
+		wantErr:   false,
+	}, {
+		name:      "3",
+		path:      `$.e`,
+		want:      nil,
+		wantFound: false,
+		wantErr:   false,
+	}, {
+		name:      "4",
+		path:      `$..[?(@.id >= 3)]`,
+		want:      map[string]interface{}{"id": float64(3), "ok": true},
+		wantFound: true,
+		wantErr:   false,
+	}, {
+		name:      "5",
+		path:      `$.o`,
+		want:      nil,
+		wantFound: false,
+		wantErr:   true,
+	}, {
+		name:      "6",
+		path:      `$.s`,
+		want:      nil,
+		wantFound: false,
+		wantErr:   true,
+	}, {
+		name:      "7",
+		path:      `$.missing`,
+		want:      nil,
+		wantFound: false,
+		wantErr:   true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, found, err := path.FindFirst(json, hasOK)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%v: FindFirst: error = %v, wantErr = %v", tt.name, err, tt.wantErr)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("%v: found = %v, want = %v", tt.name, found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want jsonpath.JSONValueType
+	}{{
+		name: "1",
+		v:    nil,
+		want: jsonpath.Type_Null,
+	}, {
+		name: "2",
+		v:    float64(1),
+		want: jsonpath.Type_Number,
+	}, {
+		name: "3",
+		v:    json.Number("1"),
+		want: jsonpath.Type_Number,
+	}, {
+		name: "4",
+		v:    "s",
+		want: jsonpath.Type_String,
+	}, {
+		name: "5",
+		v:    false,
+		want: jsonpath.Type_Boolean,
+	}, {
+		name: "6",
+		v:    map[string]interface{}{},
+		want: jsonpath.Type_Object,
+	}, {
+		name: "7",
+		v:    jsonpath.OrderedObject{},
+		want: jsonpath.Type_Object,
+	}, {
+		name: "8",
+		v:    []interface{}{},
+		want: jsonpath.Type_Array,
+	}, {
+		name: "9",
+		v:    []string{},
+		want: jsonpath.Type_Invalid,
+	}, {
+		name: "10",
+		v:    map[interface{}]interface{}{},
+		want: jsonpath.Type_Invalid,
+	}, {
+		name: "11",
+		v:    int64(1),
+		want: jsonpath.Type_Invalid,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonpath.ClassifyValue(tt.v); got != tt.want {
+				t.Errorf("%v: ClassifyValue = %v, want = %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	// The results of Query are classified in the same way as QueryTyped2.
+	doc, _ := jsonpath.ReadString(`{"a":[1,"x",true,null,{},[]]}`)
+	path, _ := jsonpath.Compile(`$.a.*`)
+	items, _ := path.QueryAll(doc)
+	for _, v := range items {
+		p, _ := jsonpath.FromAny(v)
+		q, _ := jsonpath.Compile(`$`)
+		_, typ, _ := q.QueryTyped2(p)
+		if got := jsonpath.ClassifyValue(v); got != typ {
+			t.Errorf("ClassifyValue(%v) = %v, want = %v", v, got, typ)
+		}
+	}
+}
+
+func TestJSONNumberValues(t *testing.T) {
+	doc := map[string]interface{}{
+		"n":   json.Number("2.46"),
+		"arr": []interface{}{json.Number("1"), json.Number("3"), float64(1), json.Number("5")},
+		"alt": []interface{}{float64(1), float64(4)},
+	}
+	pjson, err := jsonpath.FromAny(doc)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want interface{}
+	}{{
+		name: "1",
+		path: `$.n.(round)`,
+		want: float64(2),
+	}, {
+		name: "2",
+		path: `$.n.(formatNumber 1)`,
+		want: "2.5",
+	}, {
+		name: "3",
+		path: `$.n.(toInt)`,
+		want: float64(2),
+	}, {
+		name: "4",
+		path: `$.arr[?(@ > 2)]`,
+		want: []interface{}{json.Number("3"), json.Number("5")},
+	}, {
+		name: "5",
+		path: `$.arr.(max)`,
+		want: float64(5),
+	}, {
+		name: "6",
+		path: `$.arr.(distinctCount)`,
+		want: float64(3),
+	}, {
+		name: "7",
+		path: `$.(intersect '$.arr' '$.alt')`,
+		want: []interface{}{json.Number("1")},
+	}, {
+		name: "8",
+		path: `$.arr[?(@ == 1)]`,
+		want: []interface{}{json.Number("1"), float64(1)},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := jsonpath.QueryString(pjson, tt.path)
+			if err != nil {
+				t.Errorf("%v: QueryString: error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %#v, want = %#v", tt.name, v, tt.want)
+			}
+		})
+	}
+
+	path, _ := jsonpath.Compile(`$.n`)
+	if v := path.QueryAsNumberOrZero(pjson); v != 2.46 {
+		t.Errorf("QueryAsNumberOrZero = %v, want = %v", v, 2.46)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(`{"n":1.0,"arr":[1,2]}`))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		t.Errorf("Decode: error = %v", err)
+		return
+	}
+	pjson2, err := jsonpath.FromAny(decoded)
+	if err != nil {
+		t.Errorf("FromAny: error = %v", err)
+		return
+	}
+	plain, _ := jsonpath.ReadString(`{"n":1,"arr":[1,2]}`)
+	if !jsonpath.Equal(pjson2.Root(), plain.Root()) {
+		t.Errorf("Equal(%v, %v) = false, want = true", pjson2.Root(), plain.Root())
+	}
+	v, err := jsonpath.QueryString(pjson2, `$.n`)
+	if err != nil {
+		t.Errorf("QueryString: error = %v", err)
+		return
+	}
+	if !jsonpath.Equal(v, json.Number("1")) {
+		t.Errorf("Equal(%#v, json.Number(\"1\")) = false, want = true", v)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	const src = `{"a":[{"x":1,"y":"p"},{"x":2,"y":"q"}],"b":1,"o":{"k":{"v":3}},"d":{"x":9}}`
+
+	tests := []struct {
+		name       string
+		path       string
+		segments   []string
+		wantString string
+	}{{
+		name:       "1",
+		path:       `$.b`,
+		segments:   []string{"data"},
+		wantString: `$.data.b`,
+	}, {
+		name:       "2",
+		path:       `$`,
+		segments:   []string{"data", "inner"},
+		wantString: `$.data.inner`,
+	}, {
+		name:       "3",
+		path:       `$.a[?(@.x > $.b)].y`,
+		segments:   []string{"data"},
+		wantString: `$.data.a[?(@.x > $.data.b)].y`,
+	}, {
+		name:       "4",
+		path:       `$..v`,
+		segments:   []string{"data"},
+		wantString: `$.data..v`,
+	}, {
+		name:       "5",
+		path:       `$.a.(findIndex @.x == $.b)`,
+		segments:   []string{"data"},
+		wantString: `$.data.a.(findIndex @.x == $.data.b)`,
+	}, {
+		name:       "6",
+		path:       `$.(merge '$.d' '$.o.k')`,
+		segments:   []string{"data"},
+		wantString: `$.data.(merge '$.data.d' '$.data.o.k')`,
+	}, {
+		name:       "7",
+		path:       `$.a.(sumOf '@.x')`,
+		segments:   []string{"data"},
+		wantString: `$.data.a.(sumOf '@.x')`,
+	}, {
+		name:       "8",
+		path:       `$['a','b']`,
+		segments:   []string{"a b"},
+		wantString: `$['a b']['a','b']`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+			wrapped := json.Root()
+			for i := len(tt.segments) - 1; i >= 0; i-- {
+				wrapped = map[string]interface{}{tt.segments[i]: wrapped}
+			}
+			wrappedJSON, err := jsonpath.FromAny(wrapped)
+			if err != nil {
+				t.Errorf("%v: FromAny: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+			want, err := path.Query(json)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+
+			before := path.String()
+			prefixed := path.Prefix(tt.segments...)
+			if s := prefixed.String(); s != tt.wantString {
+				t.Errorf("%v: String() = %v, want = %v", tt.name, s, tt.wantString)
+			}
+			if s := path.String(); s != before {
+				t.Errorf("%v: original path is modified: %v, want = %v", tt.name, s, before)
+			}
+
+			v, err := prefixed.Query(wrappedJSON)
+			if err != nil {
+				t.Errorf("%v: Query (prefixed): error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(v, want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, want)
+			}
+
+			// The original path still queries the original document.
+			v, err = path.Query(json)
+			if err != nil || !reflect.DeepEqual(v, want) {
+				t.Errorf("%v: Query (original): v = %v, error = %v", tt.name, v, err)
+			}
+
+			// The text form compiles to the equivalent path.
+			path2, err := jsonpath.Compile(prefixed.String())
+			if err != nil || !path2.Equal(prefixed) {
+				t.Errorf("%v: Compile (text form): error = %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestWildcardOrder(t *testing.T) {
+	var sb strings.Builder
+	keys := make([]string, 0, 100)
+	sb.WriteString(`{`)
+	for i := 0; i < 100; i++ {
+		// NOTE: The keys are not in sorted order in the source.
+		k := strconv.Itoa((i * 37) % 100)
+		keys = append(keys, k)
+		if i > 0 {
+			sb.WriteString(`,`)
+		}
+		sb.WriteString(`"` + k + `":{"v":` + k + `}`)
+	}
+	sb.WriteString(`}`)
+
+	json, err := jsonpath.ReadString(sb.String())
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	want := make([]interface{}, len(sorted))
+	for i, k := range sorted {
+		f, _ := strconv.ParseFloat(k, 64)
+		want[i] = f
+	}
+
+	for _, p := range []string{`$.*.v`, `$[*].v`, `$..v`, `$[?(@.v >= 0)].v`, `$..[?(@.v >= 0)].v`} {
+		path, err := jsonpath.Compile(p)
+		if err != nil {
+			t.Errorf("%v: Compile: error = %v", p, err)
+			return
+		}
+		for n := 0; n < 20; n++ {
+			v, err := path.QueryAll(json)
+			if err != nil {
+				t.Errorf("%v: QueryAll: error = %v", p, err)
+				return
+			}
+			if !reflect.DeepEqual(v, want) {
+				t.Errorf("%v: v = %v, want = %v", p, v, want)
+				return
+			}
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	const src = `{"s":"abcdef","j":"日本語テキスト","e":"","arr":[10,11,12,13],"o":{"a":1}}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.s[1:4]`,
+		want:    "bcd",
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.j[1:4]`,
+		want:    "本語テ",
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.j[:2]`,
+		want:    "日本",
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.j[3:]`,
+		want:    "テキスト",
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.j[-3:]`,
+		want:    "キスト",
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.s[ -4 : -1 ]`,
+		want:    "cde",
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$.s[:]`,
+		want:    "abcdef",
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$.s[4:100]`,
+		want:    "ef",
+		wantErr: false,
+	}, {
+		name:    "9",
+		path:    `$.s[-100:2]`,
+		want:    "ab",
+		wantErr: false,
+	}, {
+		name:    "10",
+		path:    `$.s[4:2]`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "11",
+		path:    `$.e[0:1]`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "12",
+		path:    `$.arr[1:3]`,
+		want:    []interface{}{float64(11), float64(12)},
+		wantErr: false,
+	}, {
+		name:    "13",
+		path:    `$.arr[-2:]`,
+		want:    []interface{}{float64(12), float64(13)},
+		wantErr: false,
+	}, {
+		name:    "14",
+		path:    `$.arr[5:]`,
+		want:    []interface{}{},
+		wantErr: false,
+	}, {
+		name:    "15",
+		path:    `$.arr[:2][1]`,
+		want:    float64(11),
+		wantErr: false,
+	}, {
+		name:    "16",
+		path:    `$.o[0:1]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "17",
+		path:    `$.s[1:2:3]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "18",
+		path:    `$.s[1:x]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "19",
+		path:    `$.s[1:2,3]`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err == nil {
+				var v interface{}
+				v, err = path.Query(json)
+				if err == nil {
+					if tt.wantErr {
+						t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+						return
+					}
+					if !reflect.DeepEqual(v, tt.want) {
+						t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+					}
+					return
+				}
+			}
+
+			if !tt.wantErr {
+				t.Errorf("%v: error = %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestLenientIndex(t *testing.T) {
+	const src = `{"items":[10,11,{"a":12}],"e":[],"s":"ab"}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.items[2].a`,
+		want:    float64(12),
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.items[-3]`,
+		want:    float64(10),
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.items[3]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.items[-4]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.items[99]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.items[-99]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$.e[0]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$.items[99].a`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "9",
+		path:    `$.missing[0]`,
+		want:    nil,
+		wantErr: true,
+	}, {
+		name:    "10",
+		path:    `$.s[-1]`,
+		want:    "b",
+		wantErr: false,
+	}, {
+		name:    "11",
+		path:    `$.s[2]`,
+		want:    nil,
+		wantErr: false,
+	}, {
+		name:    "12",
+		path:    `$.items[99][0]`,
+		want:    nil,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{LenientIndex: true})
+			if err != nil {
+				t.Errorf("%v: CompileWithOptions: error = %v", tt.name, err)
+				return
+			}
+			v, err := path.Query(json)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("%v: Query: error = %v", tt.name, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				return
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%v: v = %v, want = %v", tt.name, v, tt.want)
+			}
+
+			// Without the option, the out of range index is an error.
+			path, _ = jsonpath.Compile(tt.path)
+			if _, err := path.Query(json); (err != nil) != (tt.want == nil) {
+				t.Errorf("%v: Query (without LenientIndex): error = %v", tt.name, err)
+			}
+		})
+	}
+
+	json, _ := jsonpath.ReadRaw(src)
+	path, _ := jsonpath.CompileWithOptions(`$.items[99].a`, jsonpath.CompileOptions{LenientIndex: true})
+	if _, err := path.Query(json); err == nil || errors.Is(err, jsonpath.ErrNullIntermediate) {
+		t.Errorf("Query: error = %v, want out of range", err)
+	}
+
+	for p, want := range map[string]bool{`$.items[2]`: true, `$.items[3]`: false, `$.items[-4]`: false, `$.s[2]`: false} {
+		path, _ := jsonpath.CompileWithOptions(p, jsonpath.CompileOptions{LenientIndex: true})
+		if got := path.Exists(json); got != want {
+			t.Errorf("%v: Exists = %v, want = %v", p, got, want)
+		}
+	}
+
+	path, _ = jsonpath.CompileWithOptions(`$.items[99]`, jsonpath.CompileOptions{LenientIndex: true})
+	if raw, err := path.QueryRaw(json); err != nil || string(raw) != `null` {
+		t.Errorf("QueryRaw = %s, %v, want = null", raw, err)
+	}
+	path, _ = jsonpath.CompileWithOptions(`$.items[99][0]`, jsonpath.CompileOptions{LenientIndex: true})
+	if _, err := path.QueryRaw(json); err == nil {
+		t.Errorf("QueryRaw: want error")
+	}
+
+	// The multi-valued paths skip the out of range index.
+	multi, _ := jsonpath.ReadString(`{"a":[[1],[2],[1,2,3,4,5,6]]}`)
+	for _, p := range []string{`$.a[*][5]`, `$..[5]`, `$.a[?(@[0] >= 1)][5]`} {
+		path, _ := jsonpath.CompileWithOptions(p, jsonpath.CompileOptions{LenientIndex: true})
+		want := []interface{}{float64(6)}
+		if v, err := path.QueryAll(multi); err != nil || !reflect.DeepEqual(v, want) {
+			t.Errorf("%v: QueryAll = %v, %v, want = %v", p, v, err, want)
+		}
+		got := make([]interface{}, 0)
+		if err := path.WalkMatches(multi, func(v interface{}) error {
+			got = append(got, v)
+			return nil
+		}); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: WalkMatches = %v, %v, want = %v", p, got, err, want)
+		}
+	}
+
+	// The paths in the filters are not lenient; the out of range index does not match null.
+	nulls, _ := jsonpath.ReadString(`{"l":[1,null],"m":[[1],[null]]}`)
+	for _, p := range []string{`$.l[?(@ == $.l[9])]`, `$.m[?(@[9] == null)]`} {
+		path, _ := jsonpath.CompileWithOptions(p, jsonpath.CompileOptions{LenientIndex: true})
+		want, _ := jsonpath.Compile(p)
+		w, _ := want.QueryAll(nulls)
+		if v, err := path.QueryAll(nulls); err != nil || !reflect.DeepEqual(v, w) || len(v) != 0 {
+			t.Errorf("%v: QueryAll = %v, %v, want = %v", p, v, err, w)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Returns the parent of the node that the path points to.
+// Only the name and number indexers can be used in the path.
+// The path should not be the root.
+func (p *CompiledJSONPath) locateParent(pjson *parsedJSON, fn string) (interface{}, *ast, error) {
+	if err := p.checkMutable(pjson, fn); err != nil {
+		return nil, nil, err
+	}
+
+	c := &queryContext{
+		root:    pjson.value,
+		opts:    p.opts,
+		ordered: pjson.ordered,
+	}
+
+	v := pjson.value
+	n := len(p.asts)
+	for i := 0; i < n-1; i++ {
+		var err error
+		v, err = p.step(c, i, &p.asts[i], v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return v, &p.asts[n-1], nil
+}
+
+func (p *CompiledJSONPath) checkMutable(pjson *parsedJSON, fn string) error {
+	if pjson.typ == Type_Invalid {
+		return errors.New(fn + ": JSON is not read")
+	}
+	if pjson.ordered {
+		return errors.New(fn + ": Ordered JSON cannot be modified")
+	}
+	for i := range p.asts {
+		switch p.asts[i].typ {
+		case astType_NameIndexer, astType_NumberIndexer:
+		default:
+			return fmt.Errorf("%v: Unsupported path segment: Level=%v", fn, i)
+		}
+	}
+	return nil
+}
+
+// Drops the source of ReadRaw, since it no longer matches the modified document.
+// QueryRaw is an error after that.
+func (p *parsedJSON) discardRaw() {
+	p.raw = nil
+	p.rawRoot = nil
+}
+
+// Returns the index in the range [0, length), or false if it is out of range.
+// A negative index counts from the end.
+func normalizeIndex(index, length int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, 0 <= index && index < length
+}
+
+// MergePatch applies the JSON Merge Patch (RFC 7386) to the node that the path points to.
+// The document is modified in place. The source kept by ReadRaw is dropped (QueryRaw is an error after that).
+// If the property does not exist in the parent object, it is created.
+// Only the name and number indexers can be used in the path.
+func (p *CompiledJSONPath) MergePatch(pjson *parsedJSON, patch interface{}) error {
+	patch, err := normalizeValue(patch, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(p.asts) == 0 {
+		if err := p.checkMutable(pjson, "MergePatch"); err != nil {
+			return err
+		}
+		pjson.value = mergePatch(pjson.value, patch)
+		pjson.typ = ClassifyValue(pjson.value)
+		pjson.discardRaw()
+		return nil
+	}
+
+	parent, a, err := p.locateParent(pjson, "MergePatch")
+	if err != nil {
+		return err
+	}
+	level := len(p.asts) - 1
+
+	switch z := parent.(type) {
+	case map[string]interface{}:
+		if a.typ != astType_NameIndexer {
+			return fmt.Errorf("MergePatch: Object cannot be accessed by number: Level=%v, %v", level, a.index)
+		}
+		pjson.discardRaw()
+		w := mergePatch(z[a.name], patch)
+		if w == nil {
+			// NOTE: The merge patch `null` deletes the property.
+			delete(z, a.name)
+		} else {
+			z[a.name] = w
+		}
+		return nil
+
+	case []interface{}:
+		if a.typ != astType_NumberIndexer {
+			return fmt.Errorf("MergePatch: Array cannot be accessed by name: Level=%v, %v", level, a.name)
+		}
+		idx, ok := normalizeIndex(a.index, len(z))
+		if !ok {
+			return fmt.Errorf("MergePatch: Index out of range: Level=%v, length=%v, %v", level, len(z), a.index)
+		}
+		pjson.discardRaw()
+		z[idx] = mergePatch(z[idx], patch)
+		return nil
+	}
+
+	return fmt.Errorf("MergePatch: Unexpected data type appeared: Level=%v", level)
+}
+
+// NOTE: Objects are merged recursively, other values replace the target.
+// null in the patch object deletes the property.
+func mergePatch(target, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = make(map[string]interface{}, len(pm))
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+		} else {
+			tm[k] = mergePatch(tm[k], v)
+		}
+	}
+	return tm
+}
+
+// ReplaceAt returns a copy of the document that the item at the index of the array
+// that the path points to is replaced with the value.
+// A negative index counts from the end.
+// The original document is not modified. Only the objects and arrays along the path are copied,
+// and the others are shared with the original.
+// Only the name and number indexers can be used in the path.
+func (p *CompiledJSONPath) ReplaceAt(pjson *parsedJSON, index int, value interface{}) (*parsedJSON, error) {
+	value, err := normalizeValue(value, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkMutable(pjson, "ReplaceAt"); err != nil {
+		return nil, err
+	}
+
+	v, err := p.copyAlong(pjson.value, 0, "ReplaceAt", func(v interface{}) (interface{}, error) {
+		z, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("ReplaceAt: Value is not an array: Level=%v", len(p.asts))
+		}
+		idx, ok := normalizeIndex(index, len(z))
+		if !ok {
+			return nil, fmt.Errorf("ReplaceAt: Index out of range: Level=%v, length=%v, %v", len(p.asts), len(z), index)
+		}
+		ret := make([]interface{}, len(z))
+		copy(ret, z)
+		ret[idx] = value
+		return ret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := newParsedJSON()
+	ret.typ = ClassifyValue(v)
+	ret.value = v
+	return ret, nil
+}
+
+// Returns a shallow copy of v that the node that the path points to (from the level) is replaced with
+// the result of update. The objects and arrays along the path are copied.
+func (p *CompiledJSONPath) copyAlong(v interface{}, level int, fn string, update func(v interface{}) (interface{}, error)) (interface{}, error) {
+	if level == len(p.asts) {
+		return update(v)
+	}
+	a := &p.asts[level]
+
+	switch z := v.(type) {
+	case map[string]interface{}:
+		if a.typ != astType_NameIndexer {
+			return nil, fmt.Errorf("%v: Object cannot be accessed by number: Level=%v, %v", fn, level, a.index)
+		}
+		w, ok := z[a.name]
+		if !ok {
+			return nil, fmt.Errorf("%v: Property %v does not exist in the object: Level=%v", fn, a.name, level)
+		}
+		w, err := p.copyAlong(w, level+1, fn, update)
+		if err != nil {
+			return nil, err
+		}
+		ret := make(map[string]interface{}, len(z))
+		for k, x := range z {
+			ret[k] = x
+		}
+		ret[a.name] = w
+		return ret, nil
+
+	case []interface{}:
+		if a.typ != astType_NumberIndexer {
+			return nil, fmt.Errorf("%v: Array cannot be accessed by name: Level=%v, %v", fn, level, a.name)
+		}
+		idx, ok := normalizeIndex(a.index, len(z))
+		if !ok {
+			return nil, fmt.Errorf("%v: Index out of range: Level=%v, length=%v, %v", fn, level, len(z), a.index)
+		}
+		w, err := p.copyAlong(z[idx], level+1, fn, update)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]interface{}, len(z))
+		copy(ret, z)
+		ret[idx] = w
+		return ret, nil
+
+	case nil:
+		return nil, fmt.Errorf("%v: Nil referenced: Level=%v", fn, level)
+	}
+
+	return nil, fmt.Errorf("%v: Unexpected data type appeared: Level=%v", fn, level)
+}
+
+// Insert inserts the value at the index of the array that the path points to.
+// The index equal to the length appends the value. A negative index counts from the end
+// (e.g. -1 inserts before the last item).
+// The document is modified in place. The source kept by ReadRaw is dropped (QueryRaw is an error after that).
+// Only the name and number indexers can be used in the path.
+func (p *CompiledJSONPath) Insert(pjson *parsedJSON, index int, value interface{}) error {
+	value, err := normalizeValue(value, nil)
+	if err != nil {
+		return err
+	}
+
+	err = p.updateArray(pjson, "Insert", func(z []interface{}) ([]interface{}, error) {
+		idx := index
+		if idx < 0 {
+			idx += len(z)
+		}
+		if idx < 0 || len(z) < idx {
+			return nil, fmt.Errorf("Insert: Index out of range: Level=%v, length=%v, %v", len(p.asts), len(z), index)
+		}
+		z = append(z, nil)
+		copy(z[idx+1:], z[idx:])
+		z[idx] = value
+		return z, nil
+	})
+	if err != nil {
+		return err
+	}
+	pjson.discardRaw()
+	return nil
+}
+
+// Append appends the values in order to the array that the path points to.
+// The document is modified in place. The source kept by ReadRaw is dropped (QueryRaw is an error after that).
+// Only the name and number indexers can be used in the path.
+func (p *CompiledJSONPath) Append(pjson *parsedJSON, values ...interface{}) error {
+	normalized := make([]interface{}, len(values))
+	for i, value := range values {
+		w, err := normalizeValue(value, nil)
+		if err != nil {
+			return err
+		}
+		normalized[i] = w
+	}
+
+	err := p.updateArray(pjson, "Append", func(z []interface{}) ([]interface{}, error) {
+		return append(z, normalized...), nil
+	})
+	if err != nil {
+		return err
+	}
+	pjson.discardRaw()
+	return nil
+}
+
+// Replaces the array that the path points to with the result of update in place.
+// The array may be grown by update, so it is written back to the parent.
+func (p *CompiledJSONPath) updateArray(pjson *parsedJSON, fn string, update func(z []interface{}) ([]interface{}, error)) error {
+	level := len(p.asts)
+
+	if level == 0 {
+		if err := p.checkMutable(pjson, fn); err != nil {
+			return err
+		}
+		z, ok := pjson.value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v: Value is not an array: Level=%v", fn, level)
+		}
+		z, err := update(z)
+		if err != nil {
+			return err
+		}
+		pjson.value = z
+		return nil
+	}
+
+	parent, a, err := p.locateParent(pjson, fn)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	var set func(z []interface{})
+
+	switch w := parent.(type) {
+	case map[string]interface{}:
+		if a.typ != astType_NameIndexer {
+			return fmt.Errorf("%v: Object cannot be accessed by number: Level=%v, %v", fn, level-1, a.index)
+		}
+		x, ok := w[a.name]
+		if !ok {
+			return fmt.Errorf("%v: Property %v does not exist in the object: Level=%v", fn, a.name, level-1)
+		}
+		v = x
+		set = func(z []interface{}) { w[a.name] = z }
+	case []interface{}:
+		if a.typ != astType_NumberIndexer {
+			return fmt.Errorf("%v: Array cannot be accessed by name: Level=%v, %v", fn, level-1, a.name)
+		}
+		idx, ok := normalizeIndex(a.index, len(w))
+		if !ok {
+			return fmt.Errorf("%v: Index out of range: Level=%v, length=%v, %v", fn, level-1, len(w), a.index)
+		}
+		v = w[idx]
+		set = func(z []interface{}) { w[idx] = z }
+	default:
+		return fmt.Errorf("%v: Unexpected data type appeared: Level=%v", fn, level-1)
+	}
+
+	z, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("%v: Value is not an array: Level=%v", fn, level)
+	}
+	if z, err = update(z); err != nil {
+		return err
+	}
+	set(z)
+	return nil
+}
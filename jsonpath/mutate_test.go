@@ -0,0 +1,621 @@
+package jsonpath_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		patch   interface{}
+		want    string
+		wantErr bool
+	}{{
+		name: "1",
+		src:  `{"a":{"b":1,"c":{"d":2,"e":3}},"z":0}`,
+		path: `$.a`,
+		patch: map[string]interface{}{
+			"b": 10,
+			"c": map[string]interface{}{"e": nil, "f": 4},
+		},
+		want:    `{"a":{"b":10,"c":{"d":2,"f":4}},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":{"b":1},"z":0}`,
+		path:    `$.a.b`,
+		patch:   "x",
+		want:    `{"a":{"b":"x"},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"a":{"b":[1,2]},"z":0}`,
+		path:    `$.a`,
+		patch:   map[string]interface{}{"b": []interface{}{3}},
+		want:    `{"a":{"b":[3]},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"a":{"b":1},"z":0}`,
+		path:    `$.a`,
+		patch:   map[string]interface{}{"b": nil, "x": nil},
+		want:    `{"a":{},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `{"a":{"b":1},"z":0}`,
+		path:    `$.a`,
+		patch:   nil,
+		want:    `{"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `{"a":"s","z":0}`,
+		path:    `$.a`,
+		patch:   map[string]interface{}{"b": map[string]interface{}{"c": nil, "d": 1}},
+		want:    `{"a":{"b":{"d":1}},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `{"z":0}`,
+		path:    `$.a`,
+		patch:   map[string]interface{}{"b": 1},
+		want:    `{"a":{"b":1},"z":0}`,
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     `{"items":[{"a":1},{"a":2}]}`,
+		path:    `$.items[1]`,
+		patch:   map[string]interface{}{"b": true},
+		want:    `{"items":[{"a":1},{"a":2,"b":true}]}`,
+		wantErr: false,
+	}, {
+		name:    "9",
+		src:     `{"a":1}`,
+		path:    `$`,
+		patch:   map[string]interface{}{"a": nil, "b": 2},
+		want:    `{"b":2}`,
+		wantErr: false,
+	}, {
+		name:    "10",
+		src:     `{"a":1}`,
+		path:    `$`,
+		patch:   []interface{}{1},
+		want:    `[1]`,
+		wantErr: false,
+	}, {
+		name:    "11",
+		src:     `{"items":[1]}`,
+		path:    `$.items[1]`,
+		patch:   1,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "12",
+		src:     `{"a":{"b":1}}`,
+		path:    `$.x.y`,
+		patch:   1,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "13",
+		src:     `{"a":{"b":1}}`,
+		path:    `$..b`,
+		patch:   1,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "14",
+		src:     `{"a":{"b":1}}`,
+		path:    `$.a`,
+		patch:   map[string]interface{}{"b": struct{}{}},
+		want:    ``,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			err = path.MergePatch(json, tt.patch)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: MergePatch: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: MergePatch: error = %v", tt.name, err)
+				return
+			}
+
+			want, err := jsonpath.ReadString(tt.want)
+			if err != nil {
+				t.Errorf("%v: ReadString (want): error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(json.Root(), want.Root()) {
+				b, _ := json.MarshalStable()
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(b), tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestMergePatchRaw(t *testing.T) {
+	json, err := jsonpath.ReadRaw(`{"a":{"x":1},"b":2}`)
+	if err != nil {
+		t.Errorf("ReadRaw: error = %v", err)
+		return
+	}
+
+	path, _ := jsonpath.Compile(`$.a`)
+	if err := path.MergePatch(json, map[string]interface{}{"x": 99}); err != nil {
+		t.Errorf("MergePatch: error = %v", err)
+		return
+	}
+
+	// The stale source is not returned.
+	if raw, err := path.QueryRaw(json); err == nil {
+		t.Errorf("QueryRaw = %s, want error", raw)
+	}
+	if v, err := path.Query(json); err != nil || !reflect.DeepEqual(v, map[string]interface{}{"x": float64(99)}) {
+		t.Errorf("Query = %v, %v", v, err)
+	}
+}
+
+func TestReplaceAt(t *testing.T) {
+	const src = `{"a":{"items":[1,2,3],"x":{"y":0}},"b":[[0]],"s":"str"}`
+
+	tests := []struct {
+		name    string
+		path    string
+		index   int
+		value   interface{}
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.a.items`,
+		index:   0,
+		value:   "x",
+		want:    `{"a":{"items":["x",2,3],"x":{"y":0}},"b":[[0]],"s":"str"}`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.a.items`,
+		index:   -1,
+		value:   map[string]interface{}{"z": 1},
+		want:    `{"a":{"items":[1,2,{"z":1}],"x":{"y":0}},"b":[[0]],"s":"str"}`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.a.items`,
+		index:   -3,
+		value:   nil,
+		want:    `{"a":{"items":[null,2,3],"x":{"y":0}},"b":[[0]],"s":"str"}`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.b[0]`,
+		index:   0,
+		value:   true,
+		want:    `{"a":{"items":[1,2,3],"x":{"y":0}},"b":[[true]],"s":"str"}`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.a.items`,
+		index:   3,
+		value:   1,
+		wantErr: true,
+	}, {
+		name:    "6",
+		path:    `$.a.items`,
+		index:   -4,
+		value:   1,
+		wantErr: true,
+	}, {
+		name:    "7",
+		path:    `$.s`,
+		index:   0,
+		value:   1,
+		wantErr: true,
+	}, {
+		name:    "8",
+		path:    `$.missing`,
+		index:   0,
+		value:   1,
+		wantErr: true,
+	}, {
+		name:    "9",
+		path:    `$..items`,
+		index:   0,
+		value:   1,
+		wantErr: true,
+	}, {
+		name:    "10",
+		path:    `$.a.items`,
+		index:   0,
+		value:   struct{}{},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			json2, err := path.ReplaceAt(json, tt.index, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: ReplaceAt: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: ReplaceAt: error = %v", tt.name, err)
+				return
+			}
+
+			want, err := jsonpath.ReadString(tt.want)
+			if err != nil {
+				t.Errorf("%v: ReadString (want): error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(json2.Root(), want.Root()) {
+				b, _ := json2.MarshalStable()
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(b), tt.want)
+				return
+			}
+
+			orig, _ := jsonpath.ReadString(src)
+			if !reflect.DeepEqual(json.Root(), orig.Root()) {
+				b, _ := json.MarshalStable()
+				t.Errorf("%v: original is modified: %v", tt.name, string(b))
+			}
+		})
+	}
+}
+
+func TestReplaceAtRoot(t *testing.T) {
+	json, _ := jsonpath.ReadString(`[1,2]`)
+	path, _ := jsonpath.Compile(`$`)
+
+	json2, err := path.ReplaceAt(json, 1, "x")
+	if err != nil {
+		t.Errorf("ReplaceAt: error = %v", err)
+		return
+	}
+	if v := json2.Root(); !reflect.DeepEqual(v, []interface{}{float64(1), "x"}) {
+		t.Errorf("v = %v", v)
+	}
+	if v := json.Root(); !reflect.DeepEqual(v, []interface{}{float64(1), float64(2)}) {
+		t.Errorf("original is modified: %v", v)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		index   int
+		value   interface{}
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   0,
+		value:   "x",
+		want:    `{"a":["x",1,2,3]}`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   1,
+		value:   "x",
+		want:    `{"a":[1,"x",2,3]}`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   2,
+		value:   "x",
+		want:    `{"a":[1,2,"x",3]}`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   3,
+		value:   "x",
+		want:    `{"a":[1,2,3,"x"]}`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   -1,
+		value:   "x",
+		want:    `{"a":[1,2,"x",3]}`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   -3,
+		value:   map[string]interface{}{"b": 1},
+		want:    `{"a":[{"b":1},1,2,3]}`,
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `{"a":[]}`,
+		path:    `$.a`,
+		index:   0,
+		value:   nil,
+		want:    `{"a":[null]}`,
+		wantErr: false,
+	}, {
+		name:    "8",
+		src:     `[[1],[2]]`,
+		path:    `$[1]`,
+		index:   1,
+		value:   3,
+		want:    `[[1],[2,3]]`,
+		wantErr: false,
+	}, {
+		name:    "9",
+		src:     `[1]`,
+		path:    `$`,
+		index:   0,
+		value:   0,
+		want:    `[0,1]`,
+		wantErr: false,
+	}, {
+		name:    "10",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   4,
+		value:   "x",
+		wantErr: true,
+	}, {
+		name:    "11",
+		src:     `{"a":[1,2,3]}`,
+		path:    `$.a`,
+		index:   -4,
+		value:   "x",
+		wantErr: true,
+	}, {
+		name:    "12",
+		src:     `{"a":{}}`,
+		path:    `$.a`,
+		index:   0,
+		value:   "x",
+		wantErr: true,
+	}, {
+		name:    "13",
+		src:     `{"a":[]}`,
+		path:    `$.b`,
+		index:   0,
+		value:   "x",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			err = path.Insert(json, tt.index, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Insert: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Insert: error = %v", tt.name, err)
+				return
+			}
+
+			want, err := jsonpath.ReadString(tt.want)
+			if err != nil {
+				t.Errorf("%v: ReadString (want): error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(json.Root(), want.Root()) {
+				b, _ := json.MarshalStable()
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(b), tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestInsertRaw(t *testing.T) {
+	json, err := jsonpath.ReadRaw(`{"l":[1,2]}`)
+	if err != nil {
+		t.Errorf("ReadRaw: error = %v", err)
+		return
+	}
+
+	path, _ := jsonpath.Compile(`$.l`)
+	if err := path.Insert(json, 0, 0.0); err != nil {
+		t.Errorf("Insert: error = %v", err)
+		return
+	}
+
+	// The stale source is not returned.
+	if raw, err := path.QueryRaw(json); err == nil {
+		t.Errorf("QueryRaw = %s, want error", raw)
+	}
+	if v, err := path.Query(json); err != nil || !reflect.DeepEqual(v, []interface{}{float64(0), float64(1), float64(2)}) {
+		t.Errorf("Query = %v, %v", v, err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		values  []interface{}
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     `{"a":[1]}`,
+		path:    `$.a`,
+		values:  []interface{}{2},
+		want:    `{"a":[1,2]}`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     `{"a":[1]}`,
+		path:    `$.a`,
+		values:  []interface{}{"x", nil, map[string]interface{}{"b": []interface{}{true}}},
+		want:    `{"a":[1,"x",null,{"b":[true]}]}`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     `{"a":[1]}`,
+		path:    `$.a`,
+		values:  nil,
+		want:    `{"a":[1]}`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     `[]`,
+		path:    `$`,
+		values:  []interface{}{1},
+		want:    `[1]`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     `[0]`,
+		path:    `$`,
+		values:  []interface{}{1, 2, 3},
+		want:    `[0,1,2,3]`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		src:     `{"a":[[],[1]]}`,
+		path:    `$.a[1]`,
+		values:  []interface{}{2},
+		want:    `{"a":[[],[1,2]]}`,
+		wantErr: false,
+	}, {
+		name:    "7",
+		src:     `{"a":"s"}`,
+		path:    `$.a`,
+		values:  []interface{}{1},
+		wantErr: true,
+	}, {
+		name:    "8",
+		src:     `{}`,
+		path:    `$`,
+		values:  []interface{}{1},
+		wantErr: true,
+	}, {
+		name:    "9",
+		src:     `{"a":[1]}`,
+		path:    `$.a`,
+		values:  []interface{}{1, struct{}{}},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadString(tt.src)
+			if err != nil {
+				t.Errorf("%v: ReadString: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			err = path.Append(json, tt.values...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: Append: want error", tt.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: Append: error = %v", tt.name, err)
+				return
+			}
+
+			want, err := jsonpath.ReadString(tt.want)
+			if err != nil {
+				t.Errorf("%v: ReadString (want): error = %v", tt.name, err)
+				return
+			}
+			if !reflect.DeepEqual(json.Root(), want.Root()) {
+				b, _ := json.MarshalStable()
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(b), tt.want)
+				return
+			}
+		})
+	}
+}
+
+func TestAppendRaw(t *testing.T) {
+	json, err := jsonpath.ReadRaw(`{"l":[1,2]}`)
+	if err != nil {
+		t.Errorf("ReadRaw: error = %v", err)
+		return
+	}
+
+	path, _ := jsonpath.Compile(`$.l`)
+	if err := path.Append(json, 3.0); err != nil {
+		t.Errorf("Append: error = %v", err)
+		return
+	}
+
+	// The stale source is not returned.
+	if raw, err := path.QueryRaw(json); err == nil {
+		t.Errorf("QueryRaw = %s, want error", raw)
+	}
+	if v, err := path.Query(json); err != nil || !reflect.DeepEqual(v, []interface{}{float64(1), float64(2), float64(3)}) {
+		t.Errorf("Query = %v, %v", v, err)
+	}
+}
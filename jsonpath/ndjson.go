@@ -0,0 +1,52 @@
+package jsonpath
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamQueryNDJSON reads the NDJSON (one JSON document per line) from in,
+// queries each document with the path, and writes each result as a JSON line to out.
+// The lines that the path fails on (e.g. missing property) and the blank lines are skipped.
+// It stops at the first malformed line (the error has the line number),
+// or at the first I/O error (wrapped with "Read" or "Write").
+func StreamQueryNDJSON(in io.Reader, path *CompiledJSONPath, out io.Writer) error {
+	r := bufio.NewReader(in)
+	w := bufio.NewWriter(out)
+
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := r.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("StreamQueryNDJSON: Read: %w", readErr)
+		}
+
+		if skipJSONSpaces(line, 0) < len(line) {
+			pjson, err := ReadString(line)
+			if err != nil {
+				return fmt.Errorf("StreamQueryNDJSON: Malformed line: Line=%v, %v", lineNo, err)
+			}
+
+			if v, err := path.Query(pjson); err == nil {
+				b, err := json.Marshal(v)
+				if err != nil {
+					return fmt.Errorf("StreamQueryNDJSON: Value cannot be marshaled: Line=%v, %v", lineNo, err)
+				}
+				b = append(b, '\n')
+				if _, err := w.Write(b); err != nil {
+					return fmt.Errorf("StreamQueryNDJSON: Write: %w", err)
+				}
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("StreamQueryNDJSON: Write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package jsonpath_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestStreamQueryNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		src:     "{\"a\":1}\n{\"a\":\"x\"}\n{\"a\":{\"b\":[true,null]}}\n",
+		path:    `$.a`,
+		want:    "1\n\"x\"\n{\"b\":[true,null]}\n",
+		wantErr: false,
+	}, {
+		name:    "2",
+		src:     "{\"a\":1}\r\n\n  \n{\"b\":2}\n{\"a\":3}",
+		path:    `$.a`,
+		want:    "1\n3\n",
+		wantErr: false,
+	}, {
+		name:    "3",
+		src:     "{\"a\":[1,2]}\n{\"a\":[]}\n",
+		path:    `$.a[*]`,
+		want:    "[1,2]\n[]\n",
+		wantErr: false,
+	}, {
+		name:    "4",
+		src:     "",
+		path:    `$.a`,
+		want:    "",
+		wantErr: false,
+	}, {
+		name:    "5",
+		src:     "{\"a\":1}\n{\"a\":\n",
+		path:    `$.a`,
+		want:    "",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			var out bytes.Buffer
+			err = jsonpath.StreamQueryNDJSON(strings.NewReader(tt.src), path, &out)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: StreamQueryNDJSON: want error", tt.name)
+				} else if !strings.Contains(err.Error(), "Line=2") {
+					t.Errorf("%v: StreamQueryNDJSON: error = %v, want the line number", tt.name, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: StreamQueryNDJSON: error = %v", tt.name, err)
+				return
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("%v: out = %q, want = %q", tt.name, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+var errTestIO = errors.New("test I/O error")
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errTestIO
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errTestIO
+}
+
+func TestStreamQueryNDJSONIOError(t *testing.T) {
+	path, _ := jsonpath.Compile(`$.a`)
+
+	err := jsonpath.StreamQueryNDJSON(failingReader{}, path, &bytes.Buffer{})
+	if !errors.Is(err, errTestIO) {
+		t.Errorf("StreamQueryNDJSON (read): error = %v, want = %v", err, errTestIO)
+	}
+
+	err = jsonpath.StreamQueryNDJSON(strings.NewReader("{\"a\":1}\n"), path, failingWriter{})
+	if !errors.Is(err, errTestIO) {
+		t.Errorf("StreamQueryNDJSON (write): error = %v, want = %v", err, errTestIO)
+	}
+}
@@ -0,0 +1,44 @@
+package jsonpath
+
+type ReadOptions struct {
+	// Accepts a single leading '+' of the top-level number (e.g. `+5`).
+	AllowLeadingPlus bool
+
+	// Interns the object keys through the map (used by ReadValueWithOptions).
+	// Sharing the map across many documents lets identical keys share one backing string.
+	// The map is not safe for concurrent use.
+	InternKeys map[string]string
+}
+
+type CompileOptions struct {
+	// Looks up the object keys case-insensitively if no key matches exactly.
+	// An exact match always wins. It is an error if more than one key matches case-insensitively.
+	CaseInsensitive bool
+
+	// Maps the name indexer applied to an array over the items (e.g. `$.items.name`),
+	// returning an array of the values of the key of each item.
+	// Otherwise it is an error that the array is accessed by name.
+	AutoMapArrays bool
+
+	// Rejects the recursive descent (`..`), the wildcards (`.*`, `[*]`), the unions (`['a','b']`)
+	// and the slices (`[0:2]`) at compile time, including the ones in the filters and the function arguments.
+	// NOTE: The filters (`[?(...)]`) are allowed.
+	DisableWildcards bool
+
+	// Allows '-' and '_' in the bare names (e.g. `$.first-name`, `$.user_id`),
+	// including the paths in the filters.
+	// NOTE: The text form (String) quotes such names (e.g. `$['first-name']`).
+	ExtendedBareNames bool
+
+	// Rejects the unknown escape sequences in the quoted names and strings (e.g. `$['\q']`).
+	// Otherwise the escaped character is taken literally (e.g. `\q` is `q`).
+	StrictEscapes bool
+
+	// Resolves the out of range index of the array or the string (e.g. `$.items[99]`, `$.items[-99]`)
+	// to null instead of the error (also in QueryRaw).
+	// NOTE: Only the last segment is lenient; `$.items[99].a` is still the out of range error,
+	// that is distinguished from the explicit null (ErrNullIntermediate). Exists reports false for it.
+	// The multi-valued paths (e.g. `$.a[*][5]`) skip it as the missing property.
+	// The paths in the filters and the function arguments are not lenient (e.g. `$.a[?(@[5] == null)]`).
+	LenientIndex bool
+}
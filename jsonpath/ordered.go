@@ -0,0 +1,181 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KeyValue is a member of OrderedObject.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedObject is the JSON object that keeps the members in the source order.
+// It is used for the objects of the documents read by ReadOrdered.
+type OrderedObject []KeyValue
+
+// Get returns the value of the key.
+func (o OrderedObject) Get(key string) (interface{}, bool) {
+	if i := o.indexOf(key); i >= 0 {
+		return o[i].Value, true
+	}
+	return nil, false
+}
+
+// Keys returns the keys in order.
+func (o OrderedObject) Keys() []string {
+	keys := make([]string, len(o))
+	for i := range o {
+		keys[i] = o[i].Key
+	}
+	return keys
+}
+
+func (o OrderedObject) indexOf(key string) int {
+	for i := range o {
+		if o[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the members as a map (not recursively).
+func (o OrderedObject) toMap() map[string]interface{} {
+	ret := make(map[string]interface{}, len(o))
+	for i := range o {
+		ret[o[i].Key] = o[i].Value
+	}
+	return ret
+}
+
+// MarshalJSON writes the members in order.
+func (o OrderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(o[i].Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ReadOrdered reads the JSON like ReadString, but the objects are decoded into OrderedObject
+// that keeps the members in the source order (json.Marshal writes them in that order).
+// If a key appears more than once, the last value wins at the position of the first one.
+// The paths navigate the objects by name as usual, and the wildcards and the recursive descent
+// visit the members in the source order.
+// NOTE: The functions see the values converted into map[string]interface{}.
+// The documents cannot be modified (MergePatch, ReplaceAt, Insert and Append are errors).
+func ReadOrdered(src string) (*parsedJSON, error) {
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.UseNumber()
+
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, fmt.Errorf("ReadOrdered: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("ReadOrdered: Unrecognised tokens appeared")
+	}
+
+	p := newParsedJSON()
+	p.typ = ClassifyValue(v)
+	p.value = v
+	p.ordered = true
+	return p, nil
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch z := tok.(type) {
+	case json.Delim:
+		switch z {
+		case '{':
+			ret := OrderedObject{}
+			// NOTE: The positions of the keys, so that the duplicated keys are found without the linear scan.
+			index := make(map[string]int)
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := tok.(string)
+				w, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				if i, ok := index[key]; ok {
+					ret[i].Value = w
+				} else {
+					index[key] = len(ret)
+					ret = append(ret, KeyValue{Key: key, Value: w})
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return ret, nil
+		case '[':
+			ret := make([]interface{}, 0)
+			for dec.More() {
+				w, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, w)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return ret, nil
+		}
+	case json.Number:
+		return strconv.ParseFloat(string(z), 64)
+	case nil, bool, string:
+		return z, nil
+	}
+	return nil, fmt.Errorf("Unexpected token: %v", tok)
+}
+
+// Converts OrderedObject into map[string]interface{} recursively.
+func plainValue(v interface{}) interface{} {
+	switch z := v.(type) {
+	case OrderedObject:
+		ret := make(map[string]interface{}, len(z))
+		for i := range z {
+			ret[z[i].Key] = plainValue(z[i].Value)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(z))
+		for i, w := range z {
+			ret[i] = plainValue(w)
+		}
+		return ret
+	}
+	return v
+}
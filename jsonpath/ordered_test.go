@@ -0,0 +1,238 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestReadOrdered(t *testing.T) {
+	const src = `{"z":1,"a":{"y":2,"b":3},"m":[{"k2":"x","k1":2}],"n":null,"e":{}}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$`,
+		want:    src,
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.a.b`,
+		want:    `3`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.a`,
+		want:    `{"y":2,"b":3}`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.a.*`,
+		want:    `[2,3]`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$['a','z']`,
+		want:    `{"a":{"y":2,"b":3},"z":1}`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$..k1`,
+		want:    `[2]`,
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$.m[?(@.k1 == 2)].k2`,
+		want:    `["x"]`,
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$.m[0].(keysCount)`,
+		want:    `2`,
+		wantErr: false,
+	}, {
+		name:    "9",
+		path:    `$.m.(first).(toJSONString)`,
+		want:    `"{\"k1\":2,\"k2\":\"x\"}"`,
+		wantErr: false,
+	}, {
+		name:    "10",
+		path:    `$.a.x`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "11",
+		path:    `$.a[0]`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "12",
+		path:    `$.e`,
+		want:    `{}`,
+		wantErr: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := jsonpath.ReadOrdered(src)
+			if err != nil {
+				t.Errorf("%v: ReadOrdered: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.Query(doc)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("%v: Query: error = %v", tt.name, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Errorf("%v: Query: want error: v = %v", tt.name, v)
+				return
+			}
+
+			b, err := json.Marshal(v)
+			if err != nil {
+				t.Errorf("%v: Marshal: error = %v", tt.name, err)
+				return
+			}
+			if string(b) != tt.want {
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(b), tt.want)
+			}
+		})
+	}
+}
+
+func TestReadOrderedDocument(t *testing.T) {
+	doc, err := jsonpath.ReadOrdered(` {"b":1,"a":[{"d":1,"c":2}],"b":3} `)
+	if err != nil {
+		t.Errorf("ReadOrdered: error = %v", err)
+		return
+	}
+
+	// The duplicated key keeps the first position.
+	b, err := json.Marshal(doc.Root())
+	if err != nil {
+		t.Errorf("Marshal: error = %v", err)
+		return
+	}
+	if want := `{"b":3,"a":[{"d":1,"c":2}]}`; string(b) != want {
+		t.Errorf("Marshal = %v, want = %v", string(b), want)
+	}
+
+	b, err = doc.MarshalStable()
+	if err != nil {
+		t.Errorf("MarshalStable: error = %v", err)
+		return
+	}
+	if want := `{"a":[{"c":2,"d":1}],"b":3}`; string(b) != want {
+		t.Errorf("MarshalStable = %v, want = %v", string(b), want)
+	}
+
+	obj, ok := doc.Root().(jsonpath.OrderedObject)
+	if !ok {
+		t.Errorf("Root: type = %T", doc.Root())
+		return
+	}
+	if keys := obj.Keys(); !reflect.DeepEqual(keys, []string{"b", "a"}) {
+		t.Errorf("Keys = %v", keys)
+	}
+	if v, ok := obj.Get("b"); !ok || v != float64(3) {
+		t.Errorf("Get = %v, %v", v, ok)
+	}
+
+	plain, _ := jsonpath.ReadString(`{"a":[{"c":2,"d":1}],"b":3}`)
+	if !jsonpath.Equal(doc.Root(), plain.Root()) {
+		t.Errorf("Equal: want true")
+	}
+
+	path, _ := jsonpath.Compile(`$.b`)
+	if err := path.MergePatch(doc, 1); err == nil {
+		t.Errorf("MergePatch: want error")
+	}
+
+	for _, src := range []string{``, `{"a":1`, `{"a":1}}`, `{"a":1} 2`, `[1,]`} {
+		if _, err := jsonpath.ReadOrdered(src); err == nil {
+			t.Errorf("ReadOrdered(%v): want error", src)
+		}
+	}
+}
+
+func TestReadOrderedPathArgs(t *testing.T) {
+	const src = `{"d":{"z":1,"a":{"y":2}},"o":{"a":{"x":3},"b":4},"a":[{"k":1},{"k":2}],"p":[{"k":1}],"s":[3,1,2],"u":[2,4]}`
+
+	doc, err := jsonpath.ReadOrdered(src)
+	if err != nil {
+		t.Errorf("ReadOrdered: error = %v", err)
+		return
+	}
+	plain, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+
+	// The path arguments see the same values as the plain document.
+	for _, p := range []string{
+		`$.(merge '$.d' '$.o')`,
+		`$.(mergeDeep '$.d' '$.o')`,
+		`$.a.(startsWithArr '$.p')`,
+		`$.(union '$.s' '$.u')`,
+		`$.(intersect '$.s' '$.u')`,
+		`$.(difference '$.s' '$.u')`,
+	} {
+		want, err := jsonpath.QueryString(plain, p)
+		if err != nil {
+			t.Errorf("%v: QueryString: error = %v", p, err)
+			return
+		}
+		got, err := jsonpath.QueryString(doc, p)
+		if err != nil {
+			t.Errorf("%v: QueryString (ordered): error = %v", p, err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got = %v, want = %v", p, got, want)
+		}
+	}
+}
+
+// NOTE: The wide object should be decoded in linear time in the number of the keys.
+func BenchmarkReadOrderedWideObject(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i < 50000; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`"k` + strconv.Itoa(i) + `":` + strconv.Itoa(i))
+	}
+	sb.WriteString(`,"k0":-1}`)
+	src := sb.String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc, err := jsonpath.ReadOrdered(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		obj := doc.Root().(jsonpath.OrderedObject)
+		if len(obj) != 50000 || obj[0].Value != float64(-1) {
+			b.Fatalf("len = %v, first = %v", len(obj), obj[0].Value)
+		}
+	}
+}
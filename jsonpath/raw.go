@@ -0,0 +1,262 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Byte offsets of the value in the source.
+type rawNode struct {
+	start int
+	end   int
+	keys  map[string]*rawNode
+	items []*rawNode
+}
+
+// ReadRaw reads the JSON like ReadString, and also keeps the source and
+// the byte offsets of each node, so that QueryRaw can return the original bytes.
+func ReadRaw(src string) (*parsedJSON, error) {
+	p, err := ReadString(src)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := []byte(src)
+	node, end, err := scanRawValue(raw, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end = skipRawSpaces(raw, end); end != len(raw) {
+		return nil, fmt.Errorf("ReadRaw: Unrecognised tokens appeared: Pos=%v", end)
+	}
+
+	p.raw = raw
+	p.rawRoot = node
+	return p, nil
+}
+
+// QueryRaw returns the original bytes of the value that the path points to.
+// Key order, spaces and number formatting of the source are preserved.
+// The JSON should be read by ReadRaw, and not be modified in place after that (e.g. by MergePatch).
+// Only the name and number indexers are supported.
+// The compile options CaseInsensitive and LenientIndex apply as in Query.
+func (p *CompiledJSONPath) QueryRaw(pjson *parsedJSON) (json.RawMessage, error) {
+	if pjson.typ == Type_Invalid {
+		return nil, errors.New("QueryRaw: JSON is not read")
+	}
+	if pjson.rawRoot == nil {
+		return nil, errors.New("QueryRaw: JSON is not read by ReadRaw, or is modified after that")
+	}
+
+	node := pjson.rawRoot
+
+	for i := range p.asts {
+		a := &p.asts[i]
+
+		switch a.typ {
+		case astType_NameIndexer:
+			if node.keys == nil {
+				return nil, fmt.Errorf("QueryRaw: Value cannot be accessed by name: Level=%v, %v", i, a.name)
+			}
+			w, ok := node.keys[a.name]
+			if !ok && p.opts.CaseInsensitive {
+				var err error
+				if w, err = lookupRawKeyFold(node.keys, a.name, i); err != nil {
+					return nil, err
+				}
+				ok = true
+			}
+			if !ok {
+				return nil, fmt.Errorf("QueryRaw: Property %v does not exist in the object: Level=%v", a.name, i)
+			}
+			node = w
+
+		case astType_NumberIndexer:
+			if node.items == nil {
+				return nil, fmt.Errorf("QueryRaw: Value cannot be accessed by number: Level=%v, %v", i, a.index)
+			}
+			length := len(node.items)
+			idx := a.index
+			if idx < 0 {
+				idx += length
+			}
+			if idx < 0 || length <= idx {
+				if p.opts.LenientIndex && i == len(p.asts)-1 {
+					return json.RawMessage("null"), nil
+				}
+				return nil, fmt.Errorf("QueryRaw: Index out of range: Level=%v, length=%v, %v", i, length, a.index)
+			}
+			node = node.items[idx]
+
+		default:
+			return nil, fmt.Errorf("QueryRaw: Unsupported path segment: Level=%v", i)
+		}
+	}
+
+	return json.RawMessage(pjson.raw[node.start:node.end]), nil
+}
+
+// Same as lookupKeyFold, but for the raw nodes.
+func lookupRawKeyFold(keys map[string]*rawNode, name string, level int) (*rawNode, error) {
+	var found []string
+	for k := range keys {
+		if strings.EqualFold(k, name) {
+			found = append(found, k)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("QueryRaw: Property %v does not exist in the object: Level=%v", name, level)
+	case 1:
+		return keys[found[0]], nil
+	}
+	sort.Strings(found)
+	return nil, fmt.Errorf("QueryRaw: Property %v is ambiguous in the object: Level=%v, %v", name, level, found)
+}
+
+func skipRawSpaces(src []byte, start int) int {
+	length := len(src)
+
+	for i := start; i < length; i++ {
+		switch src[i] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return i
+	}
+	return length
+}
+
+func scanRawValue(src []byte, start int) (*rawNode, int, error) {
+	length := len(src)
+
+	i := skipRawSpaces(src, start)
+	if i == length {
+		return nil, i, fmt.Errorf("scanRawValue: Unexpected termination: Pos=%v", i)
+	}
+
+	node := &rawNode{
+		start: i,
+	}
+
+	switch src[i] {
+	case '{':
+		node.keys = make(map[string]*rawNode)
+		i = skipRawSpaces(src, i+1)
+		if i < length && src[i] == '}' {
+			node.end = i + 1
+			return node, node.end, nil
+		}
+
+		for {
+			i = skipRawSpaces(src, i)
+			end, err := scanRawString(src, i)
+			if err != nil {
+				return nil, i, err
+			}
+
+			var key string
+			if err := json.Unmarshal(src[i:end], &key); err != nil {
+				return nil, i, err
+			}
+
+			i = skipRawSpaces(src, end)
+			if i == length || src[i] != ':' {
+				return nil, i, fmt.Errorf("scanRawValue: ':' is expected: Pos=%v", i)
+			}
+
+			child, end, err := scanRawValue(src, i+1)
+			if err != nil {
+				return nil, i, err
+			}
+			// NOTE: The last one wins if the keys are duplicated (same as encoding/json).
+			node.keys[key] = child
+
+			i = skipRawSpaces(src, end)
+			if i == length {
+				return nil, i, fmt.Errorf("scanRawValue: Unexpected termination: Pos=%v", i)
+			}
+			if src[i] == '}' {
+				node.end = i + 1
+				return node, node.end, nil
+			}
+			if src[i] != ',' {
+				return nil, i, fmt.Errorf("scanRawValue: ',' or '}' is expected: Pos=%v", i)
+			}
+			i++
+		}
+
+	case '[':
+		node.items = make([]*rawNode, 0)
+		i = skipRawSpaces(src, i+1)
+		if i < length && src[i] == ']' {
+			node.end = i + 1
+			return node, node.end, nil
+		}
+
+		for {
+			child, end, err := scanRawValue(src, i)
+			if err != nil {
+				return nil, i, err
+			}
+			node.items = append(node.items, child)
+
+			i = skipRawSpaces(src, end)
+			if i == length {
+				return nil, i, fmt.Errorf("scanRawValue: Unexpected termination: Pos=%v", i)
+			}
+			if src[i] == ']' {
+				node.end = i + 1
+				return node, node.end, nil
+			}
+			if src[i] != ',' {
+				return nil, i, fmt.Errorf("scanRawValue: ',' or ']' is expected: Pos=%v", i)
+			}
+			i++
+		}
+
+	case '"':
+		end, err := scanRawString(src, i)
+		if err != nil {
+			return nil, i, err
+		}
+		node.end = end
+		return node, end, nil
+	}
+
+	// number, true, false, null
+	end := i
+	for ; end < length; end++ {
+		ch := src[end]
+		if ch == ',' || ch == ']' || ch == '}' || ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' {
+			break
+		}
+	}
+	if end == i {
+		return nil, i, fmt.Errorf("scanRawValue: Unexpected character appeared: Pos=%v", i)
+	}
+	node.end = end
+	return node, end, nil
+}
+
+func scanRawString(src []byte, start int) (int, error) {
+	length := len(src)
+
+	if start == length || src[start] != '"' {
+		return start, fmt.Errorf("scanRawString: '\"' is expected: Pos=%v", start)
+	}
+
+	for i := start + 1; i < length; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return start, fmt.Errorf("scanRawString: Unexpected termination: Pos=%v", start)
+}
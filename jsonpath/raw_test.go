@@ -0,0 +1,212 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shellyln/go-small-jsonpath/jsonpath"
+)
+
+func TestQueryRaw(t *testing.T) {
+	const src = `{
+	"z": {"b": 1.50, "a": [1e3, -0.0, "x\"y"]},
+	"a": [ {"k": true}, null, {} , [] ],
+	"dup": 1, "dup": 2
+} `
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.z`,
+		want:    `{"b": 1.50, "a": [1e3, -0.0, "x\"y"]}`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.z.b`,
+		want:    `1.50`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.z.a[0]`,
+		want:    `1e3`,
+		wantErr: false,
+	}, {
+		name:    "4",
+		path:    `$.z.a[2]`,
+		want:    `"x\"y"`,
+		wantErr: false,
+	}, {
+		name:    "5",
+		path:    `$.a`,
+		want:    `[ {"k": true}, null, {} , [] ]`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.a[0].k`,
+		want:    `true`,
+		wantErr: false,
+	}, {
+		name:    "7",
+		path:    `$.a[2]`,
+		want:    `{}`,
+		wantErr: false,
+	}, {
+		name:    "8",
+		path:    `$.dup`,
+		want:    `2`,
+		wantErr: false,
+	}, {
+		name:    "9",
+		path:    `$`,
+		want:    src[:len(src)-1],
+		wantErr: false,
+	}, {
+		name:    "10",
+		path:    `$.a[4]`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "11",
+		path:    `$.z.c`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "12",
+		path:    `$.a.(length)`,
+		want:    ``,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			json, err := jsonpath.ReadRaw(src)
+			if err != nil {
+				t.Errorf("%v: ReadRaw: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.Compile(tt.path)
+			if err != nil {
+				t.Errorf("%v: Compile: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.QueryRaw(json)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: QueryRaw: want error: v = %v", tt.name, string(v))
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: QueryRaw: error = %v", tt.name, err)
+				return
+			}
+
+			if string(v) != tt.want {
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(v), tt.want)
+				return
+			}
+		})
+	}
+
+	json, err := jsonpath.ReadString(src)
+	if err != nil {
+		t.Errorf("ReadString: error = %v", err)
+		return
+	}
+	path, err := jsonpath.Compile(`$.z`)
+	if err != nil {
+		t.Errorf("Compile: error = %v", err)
+		return
+	}
+	if _, err := path.QueryRaw(json); err == nil {
+		t.Errorf("QueryRaw: want error")
+	}
+}
+
+func TestQueryRawCaseInsensitive(t *testing.T) {
+	const src = `{"Name": 1.0, "name": 2.0, "User": {"ID": "x", "Id": "y"}, "Items": [ 3 ]}`
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		name:    "1",
+		path:    `$.name`,
+		want:    `2.0`,
+		wantErr: false,
+	}, {
+		name:    "2",
+		path:    `$.items[0]`,
+		want:    `3`,
+		wantErr: false,
+	}, {
+		name:    "3",
+		path:    `$.NAME`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "4",
+		path:    `$.user.id`,
+		want:    ``,
+		wantErr: true,
+	}, {
+		name:    "5",
+		path:    `$.user.ID`,
+		want:    `"x"`,
+		wantErr: false,
+	}, {
+		name:    "6",
+		path:    `$.missing`,
+		want:    ``,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := jsonpath.ReadRaw(src)
+			if err != nil {
+				t.Errorf("%v: ReadRaw: error = %v", tt.name, err)
+				return
+			}
+
+			path, err := jsonpath.CompileWithOptions(tt.path, jsonpath.CompileOptions{CaseInsensitive: true})
+			if err != nil {
+				t.Errorf("%v: CompileWithOptions: error = %v", tt.name, err)
+				return
+			}
+
+			v, err := path.QueryRaw(doc)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("%v: QueryRaw: want error: v = %v", tt.name, string(v))
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%v: QueryRaw: error = %v", tt.name, err)
+				return
+			}
+			if string(v) != tt.want {
+				t.Errorf("%v: v = %v, want = %v", tt.name, string(v), tt.want)
+				return
+			}
+
+			// Query finds the same value.
+			w, err := path.Query(doc)
+			if err != nil {
+				t.Errorf("%v: Query: error = %v", tt.name, err)
+				return
+			}
+			var x interface{}
+			if err := json.Unmarshal(v, &x); err != nil || !jsonpath.Equal(x, w) {
+				t.Errorf("%v: Query: v = %v, want = %v", tt.name, w, x)
+			}
+		})
+	}
+}